@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cockroachdb/k8s/locality-checker/pkg/kubernetes"
+)
+
+var auditNodeSelector = flag.String("node-selector", "", "audit, sql: label selector restricting the audited nodes")
+var auditNamespace = flag.String("namespace", "default", "audit, sql: namespace of the CockroachDB pods and StatefulSet")
+var auditPodSelector = flag.String("pod-selector", "app=cockroachdb", "audit, sql: label selector matching CockroachDB pods")
+var auditStatefulSet = flag.String("statefulset", "cockroachdb", "audit: name of the CockroachDB StatefulSet used to check for zone skew")
+var auditFormat = flag.String("format", "table", "audit: output format, table or json")
+
+// runAudit prints the topology audit of every node.
+func runAudit(ctx context.Context, l *kubernetes.LocalityChecker) {
+	a := &kubernetes.Auditor{
+		Checker:      l,
+		NodeSelector: *auditNodeSelector,
+		Namespace:    *auditNamespace,
+		PodSelector:  *auditPodSelector,
+		StatefulSet:  *auditStatefulSet,
+	}
+	report, err := a.Audit(ctx)
+	if err != nil {
+		log.Fatalf("error auditing nodes: %v", err)
+	}
+	switch *auditFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	case "table":
+		err = printAuditTable(os.Stdout, report)
+	default:
+		log.Fatalf("unknown --format %q. Valid formats are \"table\", \"json\"", *auditFormat)
+	}
+	if err != nil {
+		log.Fatalf("error printing audit: %v", err)
+	}
+}
+
+func printAuditTable(out io.Writer, report *kubernetes.AuditReport) error {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tREGION\tZONE\tMISSING LABELS\tPODS\tLOCALITY")
+	for _, n := range report.Nodes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			n.Node,
+			orNone(n.Region),
+			orNone(n.Zone),
+			orNone(strings.Join(n.MissingLabels, ",")),
+			orNone(strings.Join(n.Pods, ",")),
+			orNone(n.Locality),
+		)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(report.Zones) > 0 {
+		fmt.Fprintln(out)
+		fmt.Fprintln(w, "ZONE\tPODS\tSKEWED")
+		for _, z := range report.Zones {
+			fmt.Fprintf(w, "%s\t%d\t%t\n", z.Zone, z.Pods, z.Skewed)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if report.Replicas > 0 {
+			fmt.Fprintf(out, "\n%d replicas over %d zones\n", report.Replicas, len(report.Zones))
+		}
+	}
+	if len(report.UnscheduledPods) > 0 {
+		fmt.Fprintf(out, "\npods not on an audited node: %s\n", strings.Join(report.UnscheduledPods, ","))
+	}
+	return nil
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
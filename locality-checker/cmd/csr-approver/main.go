@@ -0,0 +1,61 @@
+// Command csr-approver approves the certificate signing requests sent by
+// request-cert for CockroachDB pods.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cockroachdb/k8s/locality-checker/pkg/approver"
+	"github.com/cockroachdb/k8s/locality-checker/pkg/kubernetes"
+)
+
+var kubeconfig = flag.String("kubeconfig", "", "kubeconfig file if running outside the cluster; defaults to $KUBECONFIG or ~/.kube/config")
+var kubeContext = flag.String("context", "", "kubeconfig context to use instead of the current context")
+var impersonateUser = flag.String("as", "", "user to impersonate")
+var impersonateGroups = flag.String("as-group", "", "comma-separated groups to impersonate")
+var policy = flag.String("policy", "", "YAML or JSON file with the approval policy")
+var workers = flag.Int("workers", 2, "number of CSRs reviewed concurrently")
+var resync = flag.Duration("resync", 10*time.Minute, "how often pending CSRs are reviewed again without a change")
+
+func main() {
+	flag.Parse()
+
+	if *policy == "" {
+		log.Fatal("--policy is required")
+	}
+	p, err := approver.LoadPolicy(*policy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := kubernetes.ClientOptions{
+		Kubeconfig:      *kubeconfig,
+		Context:         *kubeContext,
+		ImpersonateUser: *impersonateUser,
+	}
+	if *impersonateGroups != "" {
+		opts.ImpersonateGroups = strings.Split(*impersonateGroups, ",")
+	}
+	clientset, err := kubernetes.BuildClientset(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	c := &approver.Controller{
+		Approver: &approver.Approver{Clientset: clientset, Policy: p},
+		Workers:  *workers,
+		Resync:   *resync,
+	}
+	if err := c.Run(ctx); err != nil && err != context.Canceled {
+		log.Fatal(err)
+	}
+}
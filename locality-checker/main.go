@@ -4,38 +4,258 @@ import (
 	"context"
 	"flag"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/cockroachdb/k8s/locality-checker/pkg/atomicfile"
 	"github.com/cockroachdb/k8s/locality-checker/pkg/kubernetes"
+	"github.com/cockroachdb/k8s/locality-checker/pkg/metadata"
+	"github.com/cockroachdb/k8s/locality-checker/pkg/output"
+	"github.com/pkg/errors"
+	k8s "k8s.io/client-go/kubernetes"
 )
 
 const defaultLocalityMountPath = "/etc/cockroach-locality"
 
+var kubeconfig = flag.String("kubeconfig", "", "kubeconfig file if running outside the cluster; defaults to $KUBECONFIG or ~/.kube/config")
+var kubeContext = flag.String("context", "", "kubeconfig context to use instead of the current context")
+var impersonateUser = flag.String("as", "", "user to impersonate")
+var impersonateGroups = flag.String("as-group", "", "comma-separated groups to impersonate")
+var node = flag.String("node", "", "name of the node to check; defaults to $KUBERNETES_NODE")
 var prefix = flag.String("prefix", "", "string prepended to --locality and --az flags")
+var detectPrefix = flag.Bool("detect-prefix", false, "derive --prefix from the cloud provider in the node's spec.providerID, falling back to --prefix for unknown providers")
+var providerTier = flag.String("provider-tier", "", "if non-empty, the name of a tier holding the cloud provider from the node's spec.providerID")
 var dest = flag.String("dest", defaultLocalityMountPath, "directory to which files are written")
+var fileMode = flag.String("file-mode", "0644", "octal permission bits of written files")
+var fileOwner = flag.String("file-owner", "", "if non-empty, numeric <uid>:<gid> owning written files")
+var sources = flag.String("sources", "labels,metadata,default", "comma-separated order in which tier values are looked up: labels, metadata, default")
+var metadataProviders = flag.String("metadata-providers", "", "comma-separated instance metadata services to query for the region and zone: aws, gce, azure")
+var metadataEndpoint = flag.String("metadata-endpoint", "", "if non-empty, the address used for the metadata services instead of their defaults")
+var metadataTimeout = flag.Duration("metadata-timeout", 5*time.Second, "timeout for instance metadata requests")
+var watch = flag.Bool("watch", false, "keep running and rewrite the files whenever the node's labels change")
+var resync = flag.Duration("resync", 10*time.Minute, "in --watch mode, how often the node is re-checked without a change")
+var readyAddr = flag.String("ready-addr", ":8081", "in --watch mode, address serving /readyz, which succeeds once complete locality has been written")
+var missingLabels = flag.String("missing-labels-policy", "", "what to do when a required tier has no value: skip writing locality, fail, "+
+	"or write the tier's default; defaults to $MISSING_LABELS_POLICY, or fail if $ERROR_ON_MISSING_LABELS is 1, or skip")
+var tierDefaults = flag.String("defaults", "", "comma-separated <tier>=<value> defaults used when a tier has no value, e.g. region=unknown,zone=unknown")
+var tiers tierFlag
+var outputs outputFlag
+
+func init() {
+	flag.Var(&tiers, "tier", "locality tier as <name>:<label>[,<label>...][:<options>], repeatable and "+
+		"ordered from most to least significant; options are required, optional, prefixed, key=<key> "+
+		"and default=<value> (default region and zone)")
+	flag.Var(&outputs, "output", "additional output as <format>[,file=<name>][,template=<path>], repeatable; "+
+		"formats are flag, json, yaml, env and template")
+}
+
+// tierFlag collects repeated --tier flags.
+type tierFlag []kubernetes.Tier
+
+func (f *tierFlag) String() string {
+	var s []string
+	for _, t := range *f {
+		s = append(s, t.String())
+	}
+	return strings.Join(s, " ")
+}
+
+func (f *tierFlag) Set(value string) error {
+	t, err := kubernetes.ParseTier(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, t)
+	return nil
+}
+
+// outputFlag collects repeated --output flags.
+type outputFlag struct {
+	specs   []string
+	outputs []output.Output
+}
+
+func (f *outputFlag) String() string {
+	return strings.Join(f.specs, " ")
+}
+
+func (f *outputFlag) Set(value string) error {
+	o, err := output.Parse(value)
+	if err != nil {
+		return err
+	}
+	f.specs = append(f.specs, value)
+	f.outputs = append(f.outputs, o)
+	return nil
+}
 
 func main() {
-	flag.Parse()
+	// The command is an optional first argument, followed by its flags.
+	command := "write"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	nodeName := os.Getenv("KUBERNETES_NODE")
-	if nodeName == "" {
-		log.Fatal("KUBERNETES_NODE must be set")
+	clientOpts := kubernetes.ClientOptions{
+		Kubeconfig:      *kubeconfig,
+		Context:         *kubeContext,
+		ImpersonateUser: *impersonateUser,
+	}
+	if *impersonateGroups != "" {
+		clientOpts.ImpersonateGroups = strings.Split(*impersonateGroups, ",")
 	}
-	clientset, err := kubernetes.BuildClientset()
+	clientset, err := kubernetes.BuildClientset(clientOpts)
 	if err != nil {
 		log.Fatalf("error building clientset: %v", err)
 	}
-	errorOnMissingLabels := os.Getenv("ERROR_ON_MISSING_LABELS")
-	l := kubernetes.LocalityChecker{
-		Clientset:            clientset,
-		NodeName:             nodeName,
-		WritePath:            *dest,
-		ErrorOnMissingLabels: errorOnMissingLabels == "1",
-		Prefix:               *prefix,
+	l := newLocalityChecker(clientset)
+
+	switch command {
+	case "write":
+		runWrite(ctx, l)
+	case "audit":
+		runAudit(ctx, l)
+	case "sql":
+		runSQL(ctx, l)
+	default:
+		log.Fatalf("unknown command %q. Valid commands are \"write\", \"audit\", \"sql\"", command)
+	}
+}
+
+// newLocalityChecker returns a LocalityChecker configured from the flags.
+func newLocalityChecker(clientset k8s.Interface) *kubernetes.LocalityChecker {
+	mode, err := atomicfile.ParseMode(*fileMode)
+	if err != nil {
+		log.Fatalf("invalid --file-mode: %v", err)
+	}
+	owner, err := atomicfile.ParseOwner(*fileOwner)
+	if err != nil {
+		log.Fatalf("invalid --file-owner: %v", err)
+	}
+	localitySources, err := kubernetes.ParseSources(*sources)
+	if err != nil {
+		log.Fatalf("invalid --sources: %v", err)
+	}
+	var providers []metadata.Provider
+	if *metadataProviders != "" {
+		httpClient := &http.Client{Timeout: *metadataTimeout}
+		for _, name := range strings.Split(*metadataProviders, ",") {
+			p, err := metadata.NewProvider(name, *metadataEndpoint, httpClient)
+			if err != nil {
+				log.Fatalf("invalid --metadata-providers: %v", err)
+			}
+			providers = append(providers, p)
+		}
+	}
+	policy, err := missingLabelsPolicy()
+	if err != nil {
+		log.Fatalf("invalid --missing-labels-policy: %v", err)
+	}
+	localityTiers := tiers
+	if len(localityTiers) == 0 {
+		localityTiers = kubernetes.DefaultTiers()
+	}
+	if err := applyTierDefaults(localityTiers, *tierDefaults); err != nil {
+		log.Fatalf("invalid --defaults: %v", err)
+	}
+	return &kubernetes.LocalityChecker{
+		Clientset:           clientset,
+		WritePath:           *dest,
+		FileMode:            mode,
+		FileOwner:           owner,
+		MissingLabelsPolicy: policy,
+		Prefix:              *prefix,
+		DetectPrefix:        *detectPrefix,
+		ProviderTier:        *providerTier,
+		Tiers:               localityTiers,
+		Sources:             localitySources,
+		MetadataProviders:   providers,
+		Outputs:             outputs.outputs,
+	}
+}
+
+// missingLabelsPolicy returns the policy from --missing-labels-policy, or the
+// environment.
+func missingLabelsPolicy() (kubernetes.MissingLabelsPolicy, error) {
+	if *missingLabels != "" {
+		return kubernetes.ParseMissingLabelsPolicy(*missingLabels)
+	}
+	if env := os.Getenv("MISSING_LABELS_POLICY"); env != "" {
+		return kubernetes.ParseMissingLabelsPolicy(env)
+	}
+	if os.Getenv("ERROR_ON_MISSING_LABELS") == "1" {
+		return kubernetes.MissingLabelsFail, nil
+	}
+	return kubernetes.MissingLabelsSkip, nil
+}
+
+// applyTierDefaults sets the defaults of tiers from a comma-separated list of
+// <tier>=<value> pairs.
+func applyTierDefaults(tiers []kubernetes.Tier, defaults string) error {
+	if defaults == "" {
+		return nil
+	}
+	for _, pair := range strings.Split(defaults, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return errors.Errorf("invalid default %q: expected <tier>=<value>", pair)
+		}
+		found := false
+		for i := range tiers {
+			if tiers[i].Name == parts[0] {
+				tiers[i].Default = parts[1]
+				found = true
+			}
+		}
+		if !found {
+			return errors.Errorf("invalid default %q: no tier named %s", pair, parts[0])
+		}
+	}
+	return nil
+}
+
+// runWrite writes the locality of a single node, once or in --watch mode.
+func runWrite(ctx context.Context, l *kubernetes.LocalityChecker) {
+	l.NodeName = *node
+	if l.NodeName == "" {
+		l.NodeName = os.Getenv("KUBERNETES_NODE")
+	}
+	if l.NodeName == "" {
+		log.Fatal("KUBERNETES_NODE or --node must be set")
+	}
+	if *watch {
+		go serveReadiness(*readyAddr, l)
+		if err := l.Watch(ctx, *resync); err != nil && err != context.Canceled {
+			log.Fatalf("error watching node: %v", err)
+		}
+		return
 	}
 	if err := l.WriteLocality(ctx); err != nil {
 		log.Fatalf("error writing locality: %v", err)
 	}
 }
+
+// serveReadiness serves a /readyz endpoint reporting whether l has written
+// complete locality information.
+func serveReadiness(addr string, l *kubernetes.LocalityChecker) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !l.Ready() {
+			http.Error(w, "locality not written", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatalf("error serving readiness endpoint: %v", err)
+	}
+}
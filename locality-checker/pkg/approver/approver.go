@@ -0,0 +1,419 @@
+// Package approver approves the certificate signing requests request-cert
+// sends for CockroachDB pods, after checking them against the requesting pod
+// and a Policy.
+package approver
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ApprovedReason is the reason of the Approved condition added to CSRs.
+	ApprovedReason = "CockroachDBPolicyApproved"
+	// DeniedReason is the reason of the Denied condition added to CSRs.
+	DeniedReason = "CockroachDBPolicyDenied"
+)
+
+const (
+	certTypeNode   = "node"
+	certTypeClient = "client"
+
+	// The common name of node certificates.
+	nodeCommonName = "node"
+
+	serviceAccountPrefix = "system:serviceaccount:"
+
+	// Extra attributes of users authenticated with bound service account
+	// tokens, identifying the pod the token was issued to.
+	podNameExtra = "authentication.kubernetes.io/pod-name"
+	podUIDExtra  = "authentication.kubernetes.io/pod-uid"
+)
+
+// Approver reviews CSRs against the cluster's pods and a Policy.
+type Approver struct {
+	Clientset kubernetes.Interface
+	Policy    *Policy
+}
+
+// Decision is the outcome of reviewing a CSR.
+type Decision struct {
+	Approved bool
+	Message  string
+}
+
+func approve(format string, args ...interface{}) (Decision, error) {
+	return Decision{Approved: true, Message: fmt.Sprintf(format, args...)}, nil
+}
+
+func deny(format string, args ...interface{}) (Decision, error) {
+	return Decision{Message: fmt.Sprintf(format, args...)}, nil
+}
+
+// requestName is a CSR name in request-cert's naming scheme:
+// <namespace>.node.<hostname> or <namespace>.client.<user>.
+type requestName struct {
+	namespace string
+	certType  string
+	// The pod's hostname for node certificates, or the user for client
+	// certificates.
+	subject string
+}
+
+func parseRequestName(name string) (requestName, bool) {
+	parts := strings.SplitN(name, ".", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return requestName{}, false
+	}
+	if parts[1] != certTypeNode && parts[1] != certTypeClient {
+		return requestName{}, false
+	}
+	return requestName{namespace: parts[0], certType: parts[1], subject: parts[2]}, true
+}
+
+// Reviewable returns whether csr is a pending CSR named in request-cert's
+// scheme and sent to the policy's signer. Other CSRs, and all CSRs if the
+// policy is invalid, are left alone.
+func (a *Approver) Reviewable(csr *certificatesv1.CertificateSigningRequest) bool {
+	if _, ok := parseRequestName(csr.Name); !ok {
+		return false
+	}
+	if a.Policy.Validate() != nil || csr.Spec.SignerName != a.Policy.SignerName {
+		return false
+	}
+	for _, cond := range csr.Status.Conditions {
+		switch cond.Type {
+		case certificatesv1.CertificateApproved, certificatesv1.CertificateDenied, certificatesv1.CertificateFailed:
+			return false
+		}
+	}
+	return true
+}
+
+// Review decides whether csr should be approved. An error is returned if the
+// decision could not be made, e.g. because the API server was unavailable.
+func (a *Approver) Review(ctx context.Context, csr *certificatesv1.CertificateSigningRequest) (Decision, error) {
+	name, ok := parseRequestName(csr.Name)
+	if !ok {
+		return deny("CSR name %s does not match <namespace>.node.<hostname> or <namespace>.client.<user>", csr.Name)
+	}
+	if !a.Policy.allowsNamespace(name.namespace) {
+		return deny("namespace %s is not allowed by the policy", name.namespace)
+	}
+
+	if !strings.HasPrefix(csr.Spec.Username, serviceAccountPrefix) {
+		return deny("CSR was not requested by a service account, but by %s", csr.Spec.Username)
+	}
+	saNamespace, sa, ok := splitServiceAccount(strings.TrimPrefix(csr.Spec.Username, serviceAccountPrefix))
+	if !ok || saNamespace != name.namespace {
+		return deny("CSR for namespace %s was requested by %s", name.namespace, csr.Spec.Username)
+	}
+	if !a.Policy.allowsServiceAccount(sa) {
+		return deny("service account %s/%s is not allowed by the policy", saNamespace, sa)
+	}
+	if _, err := a.Clientset.CoreV1().ServiceAccounts(saNamespace).Get(ctx, sa, metav1.GetOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return deny("service account %s/%s not found", saNamespace, sa)
+		}
+		return Decision{}, errors.Wrapf(err, "error getting service account %s/%s", saNamespace, sa)
+	}
+
+	req, err := parseRequest(csr.Spec.Request)
+	if err != nil {
+		return deny("%v", err)
+	}
+	if err := checkUsages(name.certType, csr.Spec.Usages); err != nil {
+		return deny("%v", err)
+	}
+
+	if name.certType == certTypeClient {
+		if problem := a.checkClientRequest(req, name.subject); problem != "" {
+			return deny("%s", problem)
+		}
+		pod, problem, err := a.clientPod(ctx, csr, name.namespace, sa)
+		if err != nil || problem != "" {
+			return Decision{Message: problem}, err
+		}
+		return approve("client certificate for user %s requested by pod %s/%s", name.subject, pod.Namespace, pod.Name)
+	}
+
+	pod, problem, err := a.nodePod(ctx, csr, name, sa)
+	if err != nil || problem != "" {
+		return Decision{Message: problem}, err
+	}
+	problem, err = a.checkNodeRequest(ctx, req, pod)
+	if err != nil || problem != "" {
+		return Decision{Message: problem}, err
+	}
+	return approve("node certificate for pod %s/%s", pod.Namespace, pod.Name)
+}
+
+// Update adds the condition for decision to csr.
+func (a *Approver) Update(
+	ctx context.Context, csr *certificatesv1.CertificateSigningRequest, decision Decision,
+) error {
+	csr = csr.DeepCopy()
+	cond := certificatesv1.CertificateSigningRequestCondition{
+		Type:           certificatesv1.CertificateDenied,
+		Status:         corev1.ConditionTrue,
+		Reason:         DeniedReason,
+		Message:        decision.Message,
+		LastUpdateTime: metav1.Now(),
+	}
+	if decision.Approved {
+		cond.Type = certificatesv1.CertificateApproved
+		cond.Reason = ApprovedReason
+	}
+	csr.Status.Conditions = append(csr.Status.Conditions, cond)
+	_, err := a.Clientset.CertificatesV1().CertificateSigningRequests().UpdateApproval(
+		ctx, csr.Name, csr, metav1.UpdateOptions{})
+	return errors.Wrapf(err, "error updating approval of CSR %s", csr.Name)
+}
+
+func splitServiceAccount(s string) (namespace string, name string, ok bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+func parseRequest(pemCSR []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(pemCSR)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("no PEM-encoded certificate request found")
+	}
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate request")
+	}
+	if err := req.CheckSignature(); err != nil {
+		return nil, errors.Wrap(err, "invalid certificate request signature")
+	}
+	return req, nil
+}
+
+// checkUsages returns an error if usages include any request-cert doesn't
+// request for the certificate type.
+func checkUsages(certType string, usages []certificatesv1.KeyUsage) error {
+	allowed := []certificatesv1.KeyUsage{
+		certificatesv1.UsageDigitalSignature,
+		certificatesv1.UsageKeyEncipherment,
+		certificatesv1.UsageClientAuth,
+	}
+	if certType == certTypeNode {
+		allowed = append(allowed, certificatesv1.UsageServerAuth)
+	}
+	for _, usage := range usages {
+		found := false
+		for _, a := range allowed {
+			if usage == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("usage %q is not allowed for %s certificates", usage, certType)
+		}
+	}
+	return nil
+}
+
+func (a *Approver) checkClientRequest(req *x509.CertificateRequest, user string) string {
+	if !contains(a.Policy.Users, user) {
+		return fmt.Sprintf("user %s is not allowed by the policy", user)
+	}
+	if req.Subject.CommonName != user {
+		return fmt.Sprintf("common name %s does not match user %s", req.Subject.CommonName, user)
+	}
+	if len(req.DNSNames) > 0 || len(req.IPAddresses) > 0 || len(req.EmailAddresses) > 0 || len(req.URIs) > 0 {
+		return "client certificates must not have subject alternative names"
+	}
+	return ""
+}
+
+// clientPod returns a pod running as the service account which requested a
+// client certificate: the pod the token was bound to if known, or any running
+// pod using the service account.
+func (a *Approver) clientPod(
+	ctx context.Context, csr *certificatesv1.CertificateSigningRequest, namespace string, sa string,
+) (*corev1.Pod, string, error) {
+	if podName := extraValue(csr, podNameExtra); podName != "" {
+		return a.getPod(ctx, csr, namespace, podName, sa)
+	}
+	pods, err := a.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "error listing pods in %s", namespace)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.ServiceAccountName == sa && pod.DeletionTimestamp == nil &&
+			pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			return pod, "", nil
+		}
+	}
+	return nil, fmt.Sprintf("no running pod uses service account %s/%s", namespace, sa), nil
+}
+
+// nodePod returns the pod which requested a node certificate. Its name is the
+// hostname in the CSR name, which must match the pod the token was bound to if
+// known.
+func (a *Approver) nodePod(
+	ctx context.Context, csr *certificatesv1.CertificateSigningRequest, name requestName, sa string,
+) (*corev1.Pod, string, error) {
+	if podName := extraValue(csr, podNameExtra); podName != "" && podName != name.subject {
+		return nil, fmt.Sprintf("CSR for pod %s was requested by pod %s", name.subject, podName), nil
+	}
+	return a.getPod(ctx, csr, name.namespace, name.subject, sa)
+}
+
+func (a *Approver) getPod(
+	ctx context.Context, csr *certificatesv1.CertificateSigningRequest, namespace string, name string, sa string,
+) (*corev1.Pod, string, error) {
+	pod, err := a.Clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Sprintf("pod %s/%s not found", namespace, name), nil
+		}
+		return nil, "", errors.Wrapf(err, "error getting pod %s/%s", namespace, name)
+	}
+	if pod.Spec.ServiceAccountName != sa {
+		return nil, fmt.Sprintf("pod %s/%s runs as service account %s, not %s",
+			namespace, name, pod.Spec.ServiceAccountName, sa), nil
+	}
+	if uid := extraValue(csr, podUIDExtra); uid != "" && uid != string(pod.UID) {
+		return nil, fmt.Sprintf("pod %s/%s has UID %s, but the CSR was requested by UID %s",
+			namespace, name, pod.UID, uid), nil
+	}
+	return pod, "", nil
+}
+
+// checkNodeRequest checks the subject and SANs of a node certificate request
+// against the pod's hostname, addresses and Services.
+func (a *Approver) checkNodeRequest(
+	ctx context.Context, req *x509.CertificateRequest, pod *corev1.Pod,
+) (string, error) {
+	if req.Subject.CommonName != nodeCommonName {
+		return fmt.Sprintf("common name of node certificates must be %s, not %s",
+			nodeCommonName, req.Subject.CommonName), nil
+	}
+	if len(req.EmailAddresses) > 0 || len(req.URIs) > 0 {
+		return "node certificates must only have DNS and IP subject alternative names", nil
+	}
+
+	names, err := a.allowedDNSNames(ctx, pod)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range req.DNSNames {
+		if !names[name] {
+			return fmt.Sprintf("DNS name %s does not belong to pod %s/%s", name, pod.Namespace, pod.Name), nil
+		}
+	}
+
+	ips := allowedIPs(pod)
+	for _, ip := range req.IPAddresses {
+		found := false
+		for _, allowed := range ips {
+			if ip.Equal(allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("IP address %s does not belong to pod %s/%s", ip, pod.Namespace, pod.Name), nil
+		}
+	}
+	return "", nil
+}
+
+// allowedDNSNames returns the names a node certificate for pod may contain:
+// the pod's hostname, its name under its headless Service, and the names of
+// the headless Service, the Services in the policy and the other Services
+// selecting the pod. request-cert's --discover-addresses only discovers names
+// from this list.
+func (a *Approver) allowedDNSNames(ctx context.Context, pod *corev1.Pod) (map[string]bool, error) {
+	hostname := pod.Spec.Hostname
+	if hostname == "" {
+		hostname = pod.Name
+	}
+	names := map[string]bool{"localhost": true, hostname: true}
+
+	domain := a.Policy.clusterDomain()
+	addService := func(prefix string, svc string) {
+		for _, name := range serviceNames(svc, pod.Namespace, domain) {
+			names[prefix+name] = true
+		}
+	}
+
+	if pod.Spec.Subdomain != "" {
+		svc, err := a.Clientset.CoreV1().Services(pod.Namespace).Get(ctx, pod.Spec.Subdomain, metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "error getting service %s/%s", pod.Namespace, pod.Spec.Subdomain)
+		}
+		if err == nil && svc.Spec.ClusterIP == corev1.ClusterIPNone {
+			addService(hostname+".", svc.Name)
+			addService("", svc.Name)
+		}
+	}
+	for _, svc := range a.Policy.Services {
+		addService("", svc)
+	}
+
+	services, err := a.Clientset.CoreV1().Services(pod.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listing services in %s", pod.Namespace)
+	}
+	for _, svc := range services.Items {
+		if svc.Spec.ClusterIP == corev1.ClusterIPNone || len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		if labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(pod.Labels)) {
+			addService("", svc.Name)
+		}
+	}
+	return names, nil
+}
+
+// serviceNames returns the names a Service can be resolved with from within
+// the cluster.
+func serviceNames(svc string, namespace string, domain string) []string {
+	return []string{
+		svc,
+		svc + "." + namespace,
+		svc + "." + namespace + ".svc",
+		svc + "." + namespace + ".svc." + domain,
+	}
+}
+
+func allowedIPs(pod *corev1.Pod) []net.IP {
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	if ip := net.ParseIP(pod.Status.PodIP); ip != nil {
+		ips = append(ips, ip)
+	}
+	for _, podIP := range pod.Status.PodIPs {
+		if ip := net.ParseIP(podIP.IP); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+func extraValue(csr *certificatesv1.CertificateSigningRequest, key string) string {
+	if values := csr.Spec.Extra[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,457 @@
+package approver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net"
+	"strings"
+	"testing"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testNamespace = "crdb"
+	testSA        = "cockroachdb"
+	testSigner    = "example.com/cockroachdb"
+	testPodIP     = "10.0.0.5"
+)
+
+var (
+	nodeUsages = []certificatesv1.KeyUsage{
+		certificatesv1.UsageDigitalSignature, certificatesv1.UsageKeyEncipherment,
+		certificatesv1.UsageClientAuth, certificatesv1.UsageServerAuth,
+	}
+	clientUsages = []certificatesv1.KeyUsage{
+		certificatesv1.UsageDigitalSignature, certificatesv1.UsageKeyEncipherment, certificatesv1.UsageClientAuth,
+	}
+)
+
+func testPolicy() *Policy {
+	return &Policy{
+		Namespaces: []string{testNamespace},
+		Users:      []string{"root"},
+		Services:   []string{"cockroachdb-public"},
+		SignerName: testSigner,
+	}
+}
+
+// newTestApprover returns an Approver for a fake cluster running the pod
+// cockroachdb-0 of a StatefulSet with headless Service cockroachdb, selected
+// by the Service cockroachdb-sql.
+func newTestApprover() *Approver {
+	clientset := fake.NewSimpleClientset(
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSA}},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "cockroachdb"},
+			Spec:       corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone, Selector: map[string]string{"app": "cockroachdb"}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "cockroachdb-sql"},
+			Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.10", Selector: map[string]string{"app": "cockroachdb"}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "other"},
+			Spec:       corev1.ServiceSpec{ClusterIP: "10.96.0.11", Selector: map[string]string{"app": "other"}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testNamespace, Name: "cockroachdb-0", UID: "pod-uid",
+				Labels: map[string]string{"app": "cockroachdb"},
+			},
+			Spec: corev1.PodSpec{
+				ServiceAccountName: testSA,
+				Hostname:           "cockroachdb-0",
+				Subdomain:          "cockroachdb",
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: testPodIP},
+		},
+	)
+	return &Approver{Clientset: clientset, Policy: testPolicy()}
+}
+
+func pemCSR(t *testing.T, cn string, hosts ...string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func newCSR(name string, request []byte, usages []certificatesv1.KeyUsage) *certificatesv1.CertificateSigningRequest {
+	return &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:    request,
+			SignerName: testSigner,
+			Usages:     usages,
+			Username:   serviceAccountPrefix + testNamespace + ":" + testSA,
+		},
+	}
+}
+
+func TestReview(t *testing.T) {
+	nodeHosts := []string{
+		"localhost", "127.0.0.1", testPodIP,
+		"cockroachdb-0", "cockroachdb-0.cockroachdb.crdb.svc.cluster.local",
+		"cockroachdb", "cockroachdb-public", "cockroachdb-public.crdb.svc.cluster.local",
+	}
+
+	testCases := []struct {
+		name   string
+		csr    func(t *testing.T) *certificatesv1.CertificateSigningRequest
+		policy func(p *Policy)
+		// Approved if empty, else a substring of the denial message.
+		denied string
+	}{
+		{
+			name: "node",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.node.cockroachdb-0", pemCSR(t, "node", nodeHosts...), nodeUsages)
+			},
+		},
+		{
+			name: "node bound to pod",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				csr := newCSR("crdb.node.cockroachdb-0", pemCSR(t, "node", "cockroachdb-0"), nodeUsages)
+				csr.Spec.Extra = map[string]certificatesv1.ExtraValue{
+					podNameExtra: {"cockroachdb-0"}, podUIDExtra: {"pod-uid"},
+				}
+				return csr
+			},
+		},
+		{
+			name: "node DNS name of another host",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.node.cockroachdb-0", pemCSR(t, "node", "cockroachdb-1.cockroachdb"), nodeUsages)
+			},
+			denied: "DNS name cockroachdb-1.cockroachdb does not belong to pod crdb/cockroachdb-0",
+		},
+		{
+			name: "node IP of another pod",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.node.cockroachdb-0", pemCSR(t, "node", "10.0.0.6"), nodeUsages)
+			},
+			denied: "IP address 10.0.0.6 does not belong to pod crdb/cockroachdb-0",
+		},
+		{
+			name: "node Service not in policy",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.node.cockroachdb-0", pemCSR(t, "node", "cockroachdb-public"), nodeUsages)
+			},
+			policy: func(p *Policy) { p.Services = nil },
+			denied: "DNS name cockroachdb-public does not belong",
+		},
+		{
+			name: "node Service selecting the pod",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.node.cockroachdb-0", pemCSR(t, "node", "cockroachdb-sql.crdb.svc.cluster.local"), nodeUsages)
+			},
+			policy: func(p *Policy) { p.Services = nil },
+		},
+		{
+			name: "node Service selecting other pods",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.node.cockroachdb-0", pemCSR(t, "node", "other"), nodeUsages)
+			},
+			denied: "DNS name other does not belong",
+		},
+		{
+			name: "node common name",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.node.cockroachdb-0", pemCSR(t, "root", "cockroachdb-0"), nodeUsages)
+			},
+			denied: "common name of node certificates must be node, not root",
+		},
+		{
+			name: "node missing pod",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.node.cockroachdb-9", pemCSR(t, "node", "cockroachdb-9"), nodeUsages)
+			},
+			denied: "pod crdb/cockroachdb-9 not found",
+		},
+		{
+			name: "node requested by another pod",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				csr := newCSR("crdb.node.cockroachdb-0", pemCSR(t, "node", "cockroachdb-0"), nodeUsages)
+				csr.Spec.Extra = map[string]certificatesv1.ExtraValue{podNameExtra: {"cockroachdb-1"}}
+				return csr
+			},
+			denied: "CSR for pod cockroachdb-0 was requested by pod cockroachdb-1",
+		},
+		{
+			name: "node requested by a previous pod",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				csr := newCSR("crdb.node.cockroachdb-0", pemCSR(t, "node", "cockroachdb-0"), nodeUsages)
+				csr.Spec.Extra = map[string]certificatesv1.ExtraValue{
+					podNameExtra: {"cockroachdb-0"}, podUIDExtra: {"old-uid"},
+				}
+				return csr
+			},
+			denied: "has UID pod-uid, but the CSR was requested by UID old-uid",
+		},
+		{
+			name: "missing service account",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				csr := newCSR("crdb.node.cockroachdb-0", pemCSR(t, "node", "cockroachdb-0"), nodeUsages)
+				csr.Spec.Username = serviceAccountPrefix + testNamespace + ":deleted"
+				return csr
+			},
+			denied: "service account crdb/deleted not found",
+		},
+		{
+			name: "service account not in policy",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.node.cockroachdb-0", pemCSR(t, "node", "cockroachdb-0"), nodeUsages)
+			},
+			policy: func(p *Policy) { p.ServiceAccounts = []string{"other"} },
+			denied: "service account crdb/cockroachdb is not allowed by the policy",
+		},
+		{
+			name: "service account of another namespace",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				csr := newCSR("crdb.node.cockroachdb-0", pemCSR(t, "node", "cockroachdb-0"), nodeUsages)
+				csr.Spec.Username = serviceAccountPrefix + "default:" + testSA
+				return csr
+			},
+			denied: "CSR for namespace crdb was requested by system:serviceaccount:default:cockroachdb",
+		},
+		{
+			name: "not a service account",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				csr := newCSR("crdb.node.cockroachdb-0", pemCSR(t, "node", "cockroachdb-0"), nodeUsages)
+				csr.Spec.Username = "alice"
+				return csr
+			},
+			denied: "CSR was not requested by a service account, but by alice",
+		},
+		{
+			name: "namespace not in policy",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("other.node.cockroachdb-0", pemCSR(t, "node", "cockroachdb-0"), nodeUsages)
+			},
+			denied: "namespace other is not allowed by the policy",
+		},
+		{
+			name: "client",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.client.root", pemCSR(t, "root"), clientUsages)
+			},
+		},
+		{
+			name: "client common name",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.client.root", pemCSR(t, "admin"), clientUsages)
+			},
+			denied: "common name admin does not match user root",
+		},
+		{
+			name: "client user not in policy",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.client.admin", pemCSR(t, "admin"), clientUsages)
+			},
+			denied: "user admin is not allowed by the policy",
+		},
+		{
+			name: "client SANs",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.client.root", pemCSR(t, "root", "cockroachdb-0"), clientUsages)
+			},
+			denied: "client certificates must not have subject alternative names",
+		},
+		{
+			name: "client server auth",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.client.root", pemCSR(t, "root"), nodeUsages)
+			},
+			denied: `usage "server auth" is not allowed for client certificates`,
+		},
+		{
+			name: "invalid request",
+			csr: func(t *testing.T) *certificatesv1.CertificateSigningRequest {
+				return newCSR("crdb.client.root", []byte("not a CSR"), clientUsages)
+			},
+			denied: "no PEM-encoded certificate request found",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := newTestApprover()
+			if tc.policy != nil {
+				tc.policy(a.Policy)
+			}
+			decision, err := a.Review(context.Background(), tc.csr(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.denied == "" {
+				if !decision.Approved {
+					t.Errorf("expected approval, got denial: %s", decision.Message)
+				}
+				return
+			}
+			if decision.Approved {
+				t.Errorf("expected denial, got approval: %s", decision.Message)
+			} else if !strings.Contains(decision.Message, tc.denied) {
+				t.Errorf("expected denial containing %q, got %q", tc.denied, decision.Message)
+			}
+		})
+	}
+}
+
+func TestReviewClientWithoutPod(t *testing.T) {
+	a := &Approver{
+		Clientset: fake.NewSimpleClientset(
+			&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSA}},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "cluster-init"},
+				Spec:       corev1.PodSpec{ServiceAccountName: testSA},
+				Status:     corev1.PodStatus{Phase: corev1.PodSucceeded},
+			},
+		),
+		Policy: testPolicy(),
+	}
+	csr := newCSR("crdb.client.root", pemCSR(t, "root"), clientUsages)
+	decision, err := a.Review(context.Background(), csr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "no running pod uses service account crdb/cockroachdb"; decision.Approved || decision.Message != want {
+		t.Errorf("expected denial %q, got %+v", want, decision)
+	}
+}
+
+func TestReviewable(t *testing.T) {
+	testCases := []struct {
+		name   string
+		csr    func(csr *certificatesv1.CertificateSigningRequest)
+		policy func(p *Policy)
+		want   bool
+	}{
+		{name: "pending", want: true},
+		{
+			name: "other name",
+			csr:  func(csr *certificatesv1.CertificateSigningRequest) { csr.Name = "csr-abcde" },
+		},
+		{
+			name: "other signer",
+			csr: func(csr *certificatesv1.CertificateSigningRequest) {
+				csr.Spec.SignerName = certificatesv1.KubeAPIServerClientSignerName
+			},
+		},
+		{
+			name:   "policy without signer",
+			policy: func(p *Policy) { p.SignerName = "" },
+		},
+		{
+			name: "policy with built-in signer",
+			csr: func(csr *certificatesv1.CertificateSigningRequest) {
+				csr.Spec.SignerName = certificatesv1.KubeAPIServerClientSignerName
+			},
+			policy: func(p *Policy) { p.SignerName = certificatesv1.KubeAPIServerClientSignerName },
+		},
+		{
+			name: "approved",
+			csr: func(csr *certificatesv1.CertificateSigningRequest) {
+				csr.Status.Conditions = []certificatesv1.CertificateSigningRequestCondition{
+					{Type: certificatesv1.CertificateApproved, Status: corev1.ConditionTrue},
+				}
+			},
+		},
+		{
+			name: "denied",
+			csr: func(csr *certificatesv1.CertificateSigningRequest) {
+				csr.Status.Conditions = []certificatesv1.CertificateSigningRequestCondition{
+					{Type: certificatesv1.CertificateDenied, Status: corev1.ConditionTrue},
+				}
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := &Approver{Policy: testPolicy()}
+			if tc.policy != nil {
+				tc.policy(a.Policy)
+			}
+			csr := newCSR("crdb.client.root", nil, clientUsages)
+			if tc.csr != nil {
+				tc.csr(csr)
+			}
+			if got := a.Reviewable(csr); got != tc.want {
+				t.Errorf("Reviewable() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	testCases := []struct {
+		signer  string
+		wantErr bool
+	}{
+		{signer: testSigner},
+		{signer: "", wantErr: true},
+		{signer: certificatesv1.KubeAPIServerClientSignerName, wantErr: true},
+		{signer: certificatesv1.KubeletServingSignerName, wantErr: true},
+		{signer: "kubernetes.io/legacy-unknown", wantErr: true},
+	}
+	for _, tc := range testCases {
+		p := &Policy{SignerName: tc.signer}
+		if err := p.Validate(); (err != nil) != tc.wantErr {
+			t.Errorf("Validate() with signerName %q = %v, want error: %v", tc.signer, err, tc.wantErr)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	for _, approved := range []bool{true, false} {
+		a := newTestApprover()
+		csr := newCSR("crdb.client.root", pemCSR(t, "root"), clientUsages)
+		if _, err := a.Clientset.CertificatesV1().CertificateSigningRequests().Create(
+			context.Background(), csr, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Update(context.Background(), csr, Decision{Approved: approved, Message: "why"}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := a.Clientset.CertificatesV1().CertificateSigningRequests().Get(
+			context.Background(), csr.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Status.Conditions) != 1 {
+			t.Fatalf("expected 1 condition, got %+v", got.Status.Conditions)
+		}
+		cond := got.Status.Conditions[0]
+		wantType, wantReason := certificatesv1.CertificateDenied, DeniedReason
+		if approved {
+			wantType, wantReason = certificatesv1.CertificateApproved, ApprovedReason
+		}
+		if cond.Type != wantType || cond.Reason != wantReason || cond.Message != "why" ||
+			cond.Status != corev1.ConditionTrue {
+			t.Errorf("unexpected condition %+v", cond)
+		}
+	}
+}
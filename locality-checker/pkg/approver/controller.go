@@ -0,0 +1,128 @@
+package approver
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Controller watches CSRs, and approves or denies the ones the Approver can
+// review.
+type Controller struct {
+	Approver *Approver
+	// The number of CSRs reviewed concurrently. Defaults to 1.
+	Workers int
+	// How often all CSRs are requeued.
+	Resync time.Duration
+
+	queue workqueue.RateLimitingInterface
+	store cache.Store
+}
+
+// Run reviews CSRs until ctx is done.
+func (c *Controller) Run(ctx context.Context) error {
+	csrs := c.Approver.Clientset.CertificatesV1().CertificateSigningRequests()
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return csrs.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return csrs.Watch(ctx, options)
+		},
+	}
+
+	c.queue = workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "csr-approver")
+	defer c.queue.ShutDown()
+
+	var informer cache.Controller
+	c.store, informer = cache.NewInformer(lw, &certificatesv1.CertificateSigningRequest{}, c.Resync,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: c.enqueue,
+			UpdateFunc: func(_, obj interface{}) {
+				c.enqueue(obj)
+			},
+		})
+	go informer.Run(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return ctx.Err()
+	}
+	log.Printf("watching CSRs")
+
+	workers := c.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c.processNextItem(ctx) {
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	c.queue.ShutDown()
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	csr, ok := obj.(*certificatesv1.CertificateSigningRequest)
+	if !ok || !c.Approver.Reviewable(csr) {
+		return
+	}
+	c.queue.Add(csr.Name)
+}
+
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.sync(ctx, key.(string)); err != nil {
+		log.Printf("error reviewing CSR %s, retrying: %v", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// sync reviews the CSR with the given name, and approves or denies it.
+func (c *Controller) sync(ctx context.Context, name string) error {
+	obj, exists, err := c.store.GetByKey(name)
+	if err != nil || !exists {
+		return err
+	}
+	csr := obj.(*certificatesv1.CertificateSigningRequest)
+	if !c.Approver.Reviewable(csr) {
+		return nil
+	}
+
+	decision, err := c.Approver.Review(ctx, csr)
+	if err != nil {
+		return err
+	}
+	if err := c.Approver.Update(ctx, csr, decision); err != nil {
+		return err
+	}
+	if decision.Approved {
+		log.Printf("approved CSR %s: %s", name, decision.Message)
+	} else {
+		log.Printf("denied CSR %s: %s", name, decision.Message)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package approver
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultClusterDomain is the cluster domain pod and Service names are
+// qualified with when the policy doesn't set one.
+const DefaultClusterDomain = "cluster.local"
+
+// builtinSignerPrefix is the prefix of the signers built into Kubernetes,
+// which issue credentials for the API server and kubelets.
+const builtinSignerPrefix = "kubernetes.io/"
+
+// Policy decides which CSRs are approved.
+type Policy struct {
+	// The namespaces CSRs are approved in. All namespaces if empty.
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// The service accounts, in the CSR's namespace, allowed to request
+	// certificates. Any service account if empty.
+	ServiceAccounts []string `json:"serviceAccounts,omitempty"`
+
+	// The users client certificates may be issued for.
+	Users []string `json:"users,omitempty"`
+
+	// Services, in the CSR's namespace, whose names node certificates may
+	// contain in addition to the pod's headless Service and the Services
+	// selecting the pod, e.g. a Service without a selector.
+	Services []string `json:"services,omitempty"`
+
+	// Only CSRs for this signer are reviewed. Required, and must not be one of
+	// the built-in kubernetes.io signers: approving CSRs for
+	// kubernetes.io/kube-apiserver-client would hand out credentials for the
+	// Kubernetes API.
+	SignerName string `json:"signerName"`
+
+	// The cluster domain. Defaults to DefaultClusterDomain.
+	ClusterDomain string `json:"clusterDomain,omitempty"`
+}
+
+// LoadPolicy reads a YAML or JSON policy file.
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading policy %s", path)
+	}
+	var p Policy
+	if err := yaml.UnmarshalStrict(b, &p); err != nil {
+		return nil, errors.Wrapf(err, "error parsing policy %s", path)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid policy %s", path)
+	}
+	return &p, nil
+}
+
+// Validate checks that the policy names a signer the approver may approve
+// CSRs for.
+func (p *Policy) Validate() error {
+	if p.SignerName == "" {
+		return errors.New("signerName is required")
+	}
+	if strings.HasPrefix(p.SignerName, builtinSignerPrefix) {
+		return errors.Errorf("signerName %s is a built-in Kubernetes signer", p.SignerName)
+	}
+	return nil
+}
+
+func (p *Policy) clusterDomain() string {
+	if p.ClusterDomain != "" {
+		return p.ClusterDomain
+	}
+	return DefaultClusterDomain
+}
+
+func (p *Policy) allowsNamespace(ns string) bool {
+	return len(p.Namespaces) == 0 || contains(p.Namespaces, ns)
+}
+
+func (p *Policy) allowsServiceAccount(sa string) bool {
+	return len(p.ServiceAccounts) == 0 || contains(p.ServiceAccounts, sa)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
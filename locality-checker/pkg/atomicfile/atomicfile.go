@@ -0,0 +1,111 @@
+// Package atomicfile writes files so that readers never observe partial
+// contents, even if the writer crashes.
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Owner is the numeric user and group a file is owned by.
+type Owner struct {
+	UID int
+	GID int
+}
+
+// Options control the permissions of written files.
+type Options struct {
+	// The permission bits of the file.
+	Mode os.FileMode
+
+	// If non-nil, the owner of the file. Otherwise it is owned by the writing
+	// process.
+	Owner *Owner
+}
+
+// WriteFile atomically replaces the file at path with data. The data is
+// written to a temporary file in the same directory, synced, and renamed over
+// path, after which the directory is synced so the rename is durable.
+func WriteFile(path string, data []byte, opts Options) (err error) {
+	dir := filepath.Dir(path)
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "could not create temporary file for %s", path)
+	}
+	tmpPath := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := f.Write(data); err != nil {
+		return errors.Wrapf(err, "could not write %s", tmpPath)
+	}
+	if err := f.Chmod(opts.Mode); err != nil {
+		return errors.Wrapf(err, "could not set mode of %s", tmpPath)
+	}
+	if opts.Owner != nil {
+		if err := f.Chown(opts.Owner.UID, opts.Owner.GID); err != nil {
+			return errors.Wrapf(err, "could not set owner of %s", tmpPath)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrapf(err, "could not sync %s", tmpPath)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "could not close %s", tmpPath)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return errors.Wrapf(err, "could not rename %s to %s", tmpPath, path)
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrapf(err, "could not open directory %s", dir)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return errors.Wrapf(err, "could not sync directory %s", dir)
+	}
+	return nil
+}
+
+// ParseMode parses an octal permission mode such as "0644".
+func ParseMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, errors.Errorf("invalid file mode %q: expected octal permission bits such as 0644", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// ParseOwner parses an owner given as "<uid>:<gid>". An empty string returns
+// a nil owner.
+func ParseOwner(s string) (*Owner, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return nil, errors.Errorf("invalid owner %q: expected <uid>:<gid>", s)
+	}
+	uid, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, errors.Errorf("invalid owner %q: uid must be numeric", s)
+	}
+	gid, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, errors.Errorf("invalid owner %q: gid must be numeric", s)
+	}
+	return &Owner{UID: uid, GID: gid}, nil
+}
@@ -0,0 +1,230 @@
+package kubernetes
+
+import (
+	"context"
+	"sort"
+
+	"github.com/cockroachdb/k8s/locality-checker/pkg/multiregion"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Auditor reports on the topology labels of every node in the cluster, and
+// the localities CockroachDB pods are given as a result.
+type Auditor struct {
+	// The checker whose tiers, sources and prefix are audited. Its NodeName
+	// is ignored.
+	Checker *LocalityChecker
+
+	// If non-empty, only nodes matching this label selector are audited.
+	NodeSelector string
+
+	// The namespace of the CockroachDB pods and StatefulSet.
+	Namespace string
+
+	// The label selector matching CockroachDB pods.
+	PodSelector string
+
+	// The name of the CockroachDB StatefulSet. Zone skew is only reported if
+	// it is found.
+	StatefulSet string
+}
+
+// NodeAudit is the audit result of a single node.
+type NodeAudit struct {
+	Node   string `json:"node"`
+	Region string `json:"region,omitempty"`
+	Zone   string `json:"zone,omitempty"`
+	// The locality flag value pods on this node are given, empty if they
+	// start without one.
+	Locality string `json:"locality"`
+	// The tiers with no value from the node's labels.
+	MissingLabels []string `json:"missingLabels,omitempty"`
+	// The CockroachDB pods scheduled on the node.
+	Pods []string `json:"pods,omitempty"`
+
+	// The tier values making up Locality.
+	tiers []tierValue
+}
+
+// ZoneAudit is the number of CockroachDB pods in a zone.
+type ZoneAudit struct {
+	Zone string `json:"zone"`
+	Pods int    `json:"pods"`
+	// Whether the zone has more or fewer pods than an even spread of the
+	// StatefulSet's replicas over the zones.
+	Skewed bool `json:"skewed"`
+}
+
+// AuditReport is the result of an audit.
+type AuditReport struct {
+	Nodes []NodeAudit `json:"nodes"`
+	Zones []ZoneAudit `json:"zones,omitempty"`
+	// The StatefulSet's replica count, zero if it wasn't found.
+	Replicas int32 `json:"replicas,omitempty"`
+	// Pods which are not scheduled on an audited node.
+	UnscheduledPods []string `json:"unscheduledPods,omitempty"`
+}
+
+// Audit lists the nodes and CockroachDB pods and reports their localities.
+func (a *Auditor) Audit(ctx context.Context) (*AuditReport, error) {
+	nodes, err := a.Checker.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: a.NodeSelector})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing nodes failed")
+	}
+	pods, err := a.Checker.Clientset.CoreV1().Pods(a.Namespace).List(ctx, metav1.ListOptions{LabelSelector: a.PodSelector})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing pods failed")
+	}
+	podsByNode := make(map[string][]string)
+	for _, pod := range pods.Items {
+		podsByNode[pod.Spec.NodeName] = append(podsByNode[pod.Spec.NodeName], pod.Name)
+	}
+
+	// Other nodes' instance metadata can't be queried, and a missing label
+	// should result in a pod without locality rather than an error.
+	checker := *a.Checker
+	if checker.MissingLabelsPolicy == MissingLabelsFail {
+		checker.MissingLabelsPolicy = MissingLabelsSkip
+	}
+	checker.Sources = nil
+	for _, source := range a.Checker.sources() {
+		if source != SourceMetadata {
+			checker.Sources = append(checker.Sources, source)
+		}
+	}
+
+	report := &AuditReport{}
+	podsOnNodes := make(map[string]bool)
+	zonePods := make(map[string]int)
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		na, err := checker.auditNode(ctx, node)
+		if err != nil {
+			return nil, err
+		}
+		na.Pods = podsByNode[node.Name]
+		for _, pod := range na.Pods {
+			podsOnNodes[pod] = true
+		}
+		if na.Zone != "" {
+			zonePods[na.Zone] += len(na.Pods)
+		}
+		report.Nodes = append(report.Nodes, na)
+	}
+	for _, pod := range pods.Items {
+		if !podsOnNodes[pod.Name] {
+			report.UnscheduledPods = append(report.UnscheduledPods, pod.Name)
+		}
+	}
+
+	if a.StatefulSet != "" {
+		sts, err := a.Checker.Clientset.AppsV1().StatefulSets(a.Namespace).Get(ctx, a.StatefulSet, metav1.GetOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "getting StatefulSet %s failed", a.StatefulSet)
+		}
+		if err == nil && sts.Spec.Replicas != nil {
+			report.Replicas = *sts.Spec.Replicas
+		}
+	}
+	report.Zones = zoneSkew(zonePods, report.Replicas)
+	return report, nil
+}
+
+func (l *LocalityChecker) auditNode(ctx context.Context, node *corev1.Node) (NodeAudit, error) {
+	labels := node.GetObjectMeta().GetLabels()
+	na := NodeAudit{Node: node.Name}
+	na.Region, _ = l.getRegion(labels)
+	na.Zone, _ = l.getZone(labels)
+	for _, tier := range l.tiers() {
+		if len(tier.Labels) == 0 {
+			continue
+		}
+		if _, err := getFirstValue(labels, tier.Labels); err != nil {
+			na.MissingLabels = append(na.MissingLabels, tier.Name)
+		}
+	}
+	info, err := l.getNodeLocalityInfo(ctx, node)
+	if err != nil {
+		return na, errors.Wrapf(err, "computing locality of node %s failed", node.Name)
+	}
+	if info != nil {
+		na.Locality = info.output().Flag()
+		na.tiers = info.Tiers
+	}
+	return na, nil
+}
+
+// zoneSkew returns the number of pods per zone, flagging zones which have
+// more or fewer pods than an even spread of replicas over the zones.
+func zoneSkew(zonePods map[string]int, replicas int32) []ZoneAudit {
+	var zones []ZoneAudit
+	for zone, pods := range zonePods {
+		zones = append(zones, ZoneAudit{Zone: zone, Pods: pods})
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].Zone < zones[j].Zone })
+	if replicas == 0 || len(zones) == 0 {
+		return zones
+	}
+	min := int(replicas) / len(zones)
+	max := min
+	if int(replicas)%len(zones) != 0 {
+		max++
+	}
+	for i := range zones {
+		zones[i].Skewed = zones[i].Pods < min || zones[i].Pods > max
+	}
+	return zones
+}
+
+// getRegion returns the node's region from the labels of the region tier.
+func (l *LocalityChecker) getRegion(labels map[string]string) (string, error) {
+	return getFirstValue(labels, l.tierLabels("region", RegionLabels))
+}
+
+// getZone returns the node's zone from the labels of the zone tier.
+func (l *LocalityChecker) getZone(labels map[string]string) (string, error) {
+	return getFirstValue(labels, l.tierLabels("zone", ZoneLabels))
+}
+
+// tierLabels returns the labels of the tier with the given name, or def if
+// there is no such tier.
+func (l *LocalityChecker) tierLabels(name string, def []string) []string {
+	for _, tier := range l.tiers() {
+		if tier.Name == name && len(tier.Labels) > 0 {
+			return tier.Labels
+		}
+	}
+	return def
+}
+
+// Topology returns the regions and zones of the audited nodes which run
+// CockroachDB pods, using the locality values the pods are given.
+func (r *AuditReport) Topology() *multiregion.Topology {
+	t := &multiregion.Topology{}
+	for _, n := range r.Nodes {
+		if len(n.Pods) == 0 {
+			continue
+		}
+		var region, zone string
+		for _, tv := range n.tiers {
+			switch tv.Tier.Name {
+			case "region":
+				region = tv.Value
+				t.RegionKey = tv.Tier.localityKey()
+			case "zone":
+				zone = tv.Value
+				t.ZoneKey = tv.Tier.localityKey()
+			}
+		}
+		if region == "" || zone == "" {
+			continue
+		}
+		for range n.Pods {
+			t.AddNode(region, zone)
+		}
+	}
+	return t
+}
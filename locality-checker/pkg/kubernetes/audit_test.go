@@ -0,0 +1,162 @@
+package kubernetes
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestZoneSkew(t *testing.T) {
+	testCases := []struct {
+		name     string
+		zonePods map[string]int
+		replicas int32
+		want     []ZoneAudit
+	}{
+		{name: "no zones", replicas: 3},
+		{
+			name:     "even",
+			zonePods: map[string]int{"c": 1, "a": 1, "b": 1},
+			replicas: 3,
+			want:     []ZoneAudit{{Zone: "a", Pods: 1}, {Zone: "b", Pods: 1}, {Zone: "c", Pods: 1}},
+		},
+		{
+			name:     "uneven replicas",
+			zonePods: map[string]int{"a": 2, "b": 1, "c": 2},
+			replicas: 5,
+			want:     []ZoneAudit{{Zone: "a", Pods: 2}, {Zone: "b", Pods: 1}, {Zone: "c", Pods: 2}},
+		},
+		{
+			name:     "skewed",
+			zonePods: map[string]int{"a": 3, "b": 0, "c": 1},
+			replicas: 4,
+			want: []ZoneAudit{
+				{Zone: "a", Pods: 3, Skewed: true},
+				{Zone: "b", Pods: 0, Skewed: true},
+				{Zone: "c", Pods: 1},
+			},
+		},
+		{
+			name:     "unknown replicas",
+			zonePods: map[string]int{"a": 3, "b": 0},
+			want:     []ZoneAudit{{Zone: "a", Pods: 3}, {Zone: "b", Pods: 0}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := zoneSkew(tc.zonePods, tc.replicas); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAudit(t *testing.T) {
+	node := func(name string, labels map[string]string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	pod := func(name string, nodeName string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "crdb", Labels: map[string]string{"app": "cockroachdb"}},
+			Spec:       corev1.PodSpec{NodeName: nodeName},
+		}
+	}
+	replicas := int32(4)
+	objs := []runtime.Object{
+		node("node-a", map[string]string{
+			"topology.kubernetes.io/region": "us-east-1",
+			"topology.kubernetes.io/zone":   "us-east-1a",
+		}),
+		node("node-b", map[string]string{
+			"topology.kubernetes.io/region":          "us-east-1",
+			"failure-domain.beta.kubernetes.io/zone": "us-east-1b",
+		}),
+		node("node-c", map[string]string{"topology.kubernetes.io/region": "us-east-1"}),
+		node("control-plane", map[string]string{
+			"topology.kubernetes.io/region":  "us-east-1",
+			"topology.kubernetes.io/zone":    "us-east-1a",
+			"node-role.kubernetes.io/master": "",
+		}),
+		pod("cockroachdb-0", "node-a"),
+		pod("cockroachdb-1", "node-a"),
+		pod("cockroachdb-2", "node-b"),
+		pod("cockroachdb-3", "node-c"),
+		pod("cockroachdb-4", ""),
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "crdb"}, Spec: corev1.PodSpec{NodeName: "node-b"}},
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "cockroachdb", Namespace: "crdb"},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &replicas},
+		},
+	}
+
+	a := &Auditor{
+		Checker: &LocalityChecker{
+			Clientset:           fake.NewSimpleClientset(objs...),
+			Prefix:              "aws-",
+			MissingLabelsPolicy: MissingLabelsFail,
+		},
+		NodeSelector: "!node-role.kubernetes.io/master",
+		Namespace:    "crdb",
+		PodSelector:  "app=cockroachdb",
+		StatefulSet:  "cockroachdb",
+	}
+	report, err := a.Audit(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]NodeAudit{
+		"node-a": {
+			Node:     "node-a",
+			Region:   "us-east-1",
+			Zone:     "us-east-1a",
+			Locality: "region=aws-us-east-1,az=aws-us-east-1a",
+			Pods:     []string{"cockroachdb-0", "cockroachdb-1"},
+		},
+		"node-b": {
+			Node:     "node-b",
+			Region:   "us-east-1",
+			Zone:     "us-east-1b",
+			Locality: "region=aws-us-east-1,az=aws-us-east-1b",
+			Pods:     []string{"cockroachdb-2"},
+		},
+		// A missing required label gives the pod no locality, rather than
+		// failing the audit.
+		"node-c": {
+			Node:          "node-c",
+			Region:        "us-east-1",
+			MissingLabels: []string{"zone"},
+			Pods:          []string{"cockroachdb-3"},
+		},
+	}
+	if len(report.Nodes) != len(want) {
+		t.Fatalf("got %d nodes, want %d: %+v", len(report.Nodes), len(want), report.Nodes)
+	}
+	for _, got := range report.Nodes {
+		got.tiers = nil
+		// The fake clientset lists pods in no particular order.
+		if len(got.Pods) == 2 && got.Pods[0] > got.Pods[1] {
+			got.Pods[0], got.Pods[1] = got.Pods[1], got.Pods[0]
+		}
+		if w := want[got.Node]; !reflect.DeepEqual(got, w) {
+			t.Errorf("got %+v, want %+v", got, w)
+		}
+	}
+	if want := []string{"cockroachdb-4"}; !reflect.DeepEqual(report.UnscheduledPods, want) {
+		t.Errorf("got unscheduled pods %v, want %v", report.UnscheduledPods, want)
+	}
+	if report.Replicas != replicas {
+		t.Errorf("got %d replicas, want %d", report.Replicas, replicas)
+	}
+	// Four replicas spread over two zones should be two per zone.
+	wantZones := []ZoneAudit{{Zone: "us-east-1a", Pods: 2}, {Zone: "us-east-1b", Pods: 1, Skewed: true}}
+	if !reflect.DeepEqual(report.Zones, wantZones) {
+		t.Errorf("got zones %+v, want %+v", report.Zones, wantZones)
+	}
+}
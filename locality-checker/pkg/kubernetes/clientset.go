@@ -4,12 +4,30 @@ import (
 	"github.com/pkg/errors"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
-func BuildClientset() (kubernetes.Interface, error) {
-	config, err := rest.InClusterConfig()
+// ClientOptions configure how the clientset connects to the Kubernetes API.
+// The zero value uses the in-cluster config, or the kubeconfig found through
+// $KUBECONFIG or ~/.kube/config when running outside a cluster.
+type ClientOptions struct {
+	// The kubeconfig file to use. Overrides $KUBECONFIG if set.
+	Kubeconfig string
+
+	// The kubeconfig context to use instead of the current context.
+	Context string
+
+	// The user to impersonate, if any.
+	ImpersonateUser string
+
+	// The groups to impersonate, if any.
+	ImpersonateGroups []string
+}
+
+func BuildClientset(opts ClientOptions) (kubernetes.Interface, error) {
+	config, err := BuildConfig(opts)
 	if err != nil {
-		return nil, errors.Wrap(err, "error building kubernetes cluster config")
+		return nil, err
 	}
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
@@ -17,3 +35,23 @@ func BuildClientset() (kubernetes.Interface, error) {
 	}
 	return clientset, nil
 }
+
+// BuildConfig returns the REST config for opts.
+func BuildConfig(opts ClientOptions) (*rest.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = opts.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: opts.Context}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "error building kubernetes cluster config")
+	}
+	// Set impersonation directly on the config, as the overrides are ignored
+	// when falling back to the in-cluster config.
+	if opts.ImpersonateUser != "" || len(opts.ImpersonateGroups) > 0 {
+		config.Impersonate = rest.ImpersonationConfig{
+			UserName: opts.ImpersonateUser,
+			Groups:   opts.ImpersonateGroups,
+		}
+	}
+	return config, nil
+}
@@ -2,10 +2,16 @@ package kubernetes
 
 import (
 	"context"
-	"fmt"
-	"io/ioutil"
-
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/cockroachdb/k8s/locality-checker/pkg/atomicfile"
+	"github.com/cockroachdb/k8s/locality-checker/pkg/metadata"
+	"github.com/cockroachdb/k8s/locality-checker/pkg/output"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
@@ -20,99 +26,213 @@ type LocalityChecker struct {
 	// The directory to write locality information.
 	WritePath string
 
-	// Whether to error if node does not have region and zone labels.
-	ErrorOnMissingLabels bool
+	// The permission bits of written files. Defaults to 0644 if zero.
+	FileMode os.FileMode
+
+	// If non-nil, the owner of written files.
+	FileOwner *atomicfile.Owner
+
+	// What to do if a required tier, such as the region or zone, has no value.
+	// Defaults to MissingLabelsSkip if empty.
+	MissingLabelsPolicy MissingLabelsPolicy
 
 	// A prefix to add to locality values. Useful for prepending the cloud provider's
 	// name in front of the region and availability zone
 	Prefix string
+
+	// Whether to derive the prefix from the cloud provider in the node's
+	// spec.providerID, e.g. "aws-". Prefix is used if the provider is unknown.
+	DetectPrefix bool
+
+	// If non-empty, a tier with this name whose value is the cloud provider
+	// in the node's spec.providerID is added in front of the other tiers.
+	ProviderTier string
+
+	// The locality tiers to detect, from most to least significant. Defaults to
+	// DefaultTiers if empty.
+	Tiers []Tier
+
+	// The sources tier values are looked up from, in order. Defaults to
+	// DefaultSources if empty.
+	Sources []Source
+
+	// The instance metadata services queried by SourceMetadata, in order.
+	MetadataProviders []metadata.Provider
+
+	// Additional outputs written alongside the per-tier files and the
+	// locality flag file.
+	Outputs []output.Output
+
+	// Set to 1 once complete locality information has been written.
+	ready int32
+}
+
+type tierValue struct {
+	Tier  Tier
+	Value string
 }
 
 type localityInfo struct {
-	Region string
-	Zone   string
+	Tiers []tierValue
 }
 
 func (l *LocalityChecker) WriteLocality(ctx context.Context) error {
-	localityInfo, err := l.getLocalityInfo(ctx)
+	node, err := l.getNode(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting node labels failed")
+	}
+	return l.writeNodeLocality(ctx, node)
+}
+
+// Ready returns whether complete locality information has been written.
+func (l *LocalityChecker) Ready() bool {
+	return atomic.LoadInt32(&l.ready) == 1
+}
+
+func (l *LocalityChecker) writeNodeLocality(ctx context.Context, node *corev1.Node) error {
+	localityInfo, err := l.getNodeLocalityInfo(ctx, node)
 	if err != nil {
+		atomic.StoreInt32(&l.ready, 0)
 		return err
 	}
 	if localityInfo == nil {
+		atomic.StoreInt32(&l.ready, 0)
+		log.Printf("node %s is missing required locality labels, not writing locality", node.Name)
 		return nil
 	}
-	return l.writeLocalityInfo(ctx, localityInfo)
+	if err := l.writeLocalityInfo(ctx, localityInfo); err != nil {
+		atomic.StoreInt32(&l.ready, 0)
+		return err
+	}
+	atomic.StoreInt32(&l.ready, 1)
+	return nil
 }
 
-func (l *LocalityChecker) getLocalityInfo(ctx context.Context) (*localityInfo, error) {
-	labels, err := l.getNodeLabels(ctx)
-	if err != nil {
-		return nil, errors.Wrap(err, "getting node labels failed")
+func (l *LocalityChecker) getNodeLocalityInfo(ctx context.Context, node *corev1.Node) (*localityInfo, error) {
+	provider, _ := ParseProviderID(node.Spec.ProviderID)
+	prefix := l.Prefix
+	if l.DetectPrefix && provider != "" {
+		prefix = provider + "-"
 	}
-	region, err := l.getRegion(labels)
-	if err != nil {
-		if !l.ErrorOnMissingLabels {
-			return nil, nil
+	resolver := &tierResolver{l: l, labels: node.GetObjectMeta().GetLabels()}
+	info := &localityInfo{}
+	for _, tier := range l.tiers() {
+		var value string
+		var source Source
+		if tier.Name == l.ProviderTier && provider != "" {
+			value = provider
+		} else {
+			value, source = resolver.value(ctx, tier)
 		}
-		return nil, errors.Wrap(err, "no region labels found")
-	}
-	zone, err := l.getZone(labels)
-	if err != nil {
-		if !l.ErrorOnMissingLabels {
-			return nil, nil
+		if value == "" {
+			// The policy only applies to tiers the sources left without a value.
+			switch {
+			case l.MissingLabelsPolicy == MissingLabelsDefault && tier.Default != "":
+				value, source = tier.Default, SourceDefault
+			case !tier.Required:
+				continue
+			case l.MissingLabelsPolicy == MissingLabelsDefault:
+				value, source = DefaultLocalityValue, SourceDefault
+			case l.MissingLabelsPolicy == MissingLabelsFail:
+				return nil, errors.Errorf("no %s found", tier.Name)
+			default:
+				return nil, nil
+			}
 		}
-		return nil, errors.Wrap(err, "no zone labels found")
+		// Defaults are used as is, e.g. region=unknown rather than aws-unknown.
+		if tier.Prefixed && source != SourceDefault {
+			value = prefix + value
+		}
+		info.Tiers = append(info.Tiers, tierValue{Tier: tier, Value: value})
 	}
-	return &localityInfo{
-		Region: l.Prefix + region,
-		Zone:   l.Prefix + zone,
-	}, nil
+	return info, nil
 }
 
 func (l *LocalityChecker) writeLocalityInfo(ctx context.Context, localityInfo *localityInfo) error {
-	err := l.writeFile("region", localityInfo.Region)
-	if err != nil {
-		return err
+	written := make(map[string]bool)
+	for _, tv := range localityInfo.Tiers {
+		if err := l.writeFile(tv.Tier.Name, tv.Value); err != nil {
+			return err
+		}
+		written[tv.Tier.Name] = true
 	}
-	err = l.writeFile("zone", localityInfo.Zone)
-	if err != nil {
-		return err
+	// Remove files left behind by a previous write for tiers which no longer
+	// have a value.
+	for _, tier := range l.tiers() {
+		if written[tier.Name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(l.WritePath, tier.Name)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "removing stale %s file failed", tier.Name)
+		}
 	}
-	err = l.writeFile("locality", fmt.Sprintf(
-		"--locality=region=%s,az=%s",
-		localityInfo.Region,
-		localityInfo.Zone,
-	))
-	if err != nil {
-		return err
+
+	locality := localityInfo.output()
+	outputs := append([]output.Output{&output.Flag{Filename: "locality"}}, l.Outputs...)
+	for _, o := range outputs {
+		contents, err := o.Render(locality)
+		if err != nil {
+			return err
+		}
+		if err := l.writeFile(o.File(), string(contents)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (l *LocalityChecker) getNodeLabels(ctx context.Context) (map[string]string, error) {
-	node, err := l.Clientset.CoreV1().Nodes().Get(ctx, l.NodeName, metav1.GetOptions{})
-	if err != nil {
-		return nil, errors.Wrapf(err, "node not found")
+func (info *localityInfo) output() output.Locality {
+	var locality output.Locality
+	for _, tv := range info.Tiers {
+		locality.Tiers = append(locality.Tiers, output.Tier{
+			Name:  tv.Tier.Name,
+			Key:   tv.Tier.localityKey(),
+			Value: tv.Value,
+		})
 	}
-	return node.GetObjectMeta().GetLabels(), nil
+	return locality
 }
 
-func (l *LocalityChecker) getRegion(labels map[string]string) (string, error) {
-	return getFirstValue(labels, []string{
-		"topology.kubernetes.io/region",
-		"failure-domain.beta.kubernetes.io/region",
-	})
+func (l *LocalityChecker) tiers() []Tier {
+	tiers := l.Tiers
+	if len(tiers) == 0 {
+		tiers = DefaultTiers()
+	}
+	if l.ProviderTier == "" {
+		return tiers
+	}
+	for _, t := range tiers {
+		if t.Name == l.ProviderTier {
+			return tiers
+		}
+	}
+	return append([]Tier{{Name: l.ProviderTier}}, tiers...)
 }
 
-func (l *LocalityChecker) getZone(labels map[string]string) (string, error) {
-	return getFirstValue(labels, []string{
-		"topology.kubernetes.io/zone",
-		"failure-domain.beta.kubernetes.io/zone",
-	})
+func (l *LocalityChecker) sources() []Source {
+	if len(l.Sources) == 0 {
+		return DefaultSources
+	}
+	return l.Sources
+}
+
+func (l *LocalityChecker) getNode(ctx context.Context) (*corev1.Node, error) {
+	node, err := l.Clientset.CoreV1().Nodes().Get(ctx, l.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "node not found")
+	}
+	return node, nil
 }
 
 func (l *LocalityChecker) writeFile(localityType string, localityValue string) error {
-	return ioutil.WriteFile(fmt.Sprintf("%s/%s", l.WritePath, localityType), []byte(localityValue), 0644)
+	mode := l.FileMode
+	if mode == 0 {
+		mode = 0644
+	}
+	return atomicfile.WriteFile(filepath.Join(l.WritePath, localityType), []byte(localityValue), atomicfile.Options{
+		Mode:  mode,
+		Owner: l.FileOwner,
+	})
 }
 
 func getFirstValue(haystack map[string]string, needles []string) (string, error) {
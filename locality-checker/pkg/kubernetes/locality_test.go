@@ -0,0 +1,115 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestGetNodeLocalityInfoMissingLabels(t *testing.T) {
+	// The node has a region but no zone or rack.
+	node := testNode(map[string]string{"topology.kubernetes.io/region": "us-east-1"})
+	zone := Tier{Name: "zone", LocalityKey: "az", Labels: ZoneLabels, Required: true, Prefixed: true}
+	rack := Tier{Name: "rack", Labels: []string{"example.com/rack"}}
+	withDefault := func(t Tier, value string) Tier {
+		t.Default = value
+		return t
+	}
+
+	testCases := []struct {
+		policy  MissingLabelsPolicy
+		sources []Source
+		tiers   []Tier
+		// The locality flag, "" for no locality, or "error".
+		want string
+	}{
+		{policy: MissingLabelsSkip, tiers: []Tier{zone, rack}, want: ""},
+		{policy: MissingLabelsFail, tiers: []Tier{zone, rack}, want: "error"},
+		{policy: MissingLabelsDefault, tiers: []Tier{zone, rack}, want: "region=aws-us-east-1,az=unknown"},
+
+		// Explicit defaults are used whatever the policy, and aren't prefixed.
+		{
+			policy: MissingLabelsSkip,
+			tiers:  []Tier{withDefault(zone, "zone-0"), withDefault(rack, "rack-0")},
+			want:   "region=aws-us-east-1,az=zone-0,rack=rack-0",
+		},
+		{
+			policy: MissingLabelsFail,
+			tiers:  []Tier{withDefault(zone, "zone-0"), withDefault(rack, "rack-0")},
+			want:   "region=aws-us-east-1,az=zone-0,rack=rack-0",
+		},
+		{
+			policy: MissingLabelsDefault,
+			tiers:  []Tier{withDefault(zone, "zone-0"), withDefault(rack, "rack-0")},
+			want:   "region=aws-us-east-1,az=zone-0,rack=rack-0",
+		},
+
+		// Without the default source, the policy decides.
+		{
+			policy:  MissingLabelsSkip,
+			sources: []Source{SourceLabels},
+			tiers:   []Tier{withDefault(zone, "zone-0"), withDefault(rack, "rack-0")},
+			want:    "",
+		},
+		{
+			policy:  MissingLabelsFail,
+			sources: []Source{SourceLabels},
+			tiers:   []Tier{withDefault(zone, "zone-0"), withDefault(rack, "rack-0")},
+			want:    "error",
+		},
+		{
+			policy:  MissingLabelsDefault,
+			sources: []Source{SourceLabels},
+			tiers:   []Tier{withDefault(zone, "zone-0"), withDefault(rack, "rack-0")},
+			want:    "region=aws-us-east-1,az=zone-0,rack=rack-0",
+		},
+		{
+			policy:  MissingLabelsSkip,
+			sources: []Source{SourceLabels},
+			tiers:   []Tier{zone, withDefault(rack, "rack-0")},
+			want:    "",
+		},
+
+		// A default only stands in for a missing value.
+		{
+			policy: MissingLabelsSkip,
+			tiers:  []Tier{withDefault(DefaultTiers()[0], "region-0")},
+			want:   "region=aws-us-east-1",
+		},
+		{
+			policy:  MissingLabelsSkip,
+			sources: []Source{SourceDefault, SourceLabels},
+			tiers:   []Tier{withDefault(DefaultTiers()[0], "region-0")},
+			want:    "region=region-0",
+		},
+	}
+	for _, tc := range testCases {
+		name := fmt.Sprintf("%s/%v", tc.policy, tc.sources)
+		for _, tier := range tc.tiers {
+			name += fmt.Sprintf("/%s=%s", tier.Name, tier.Default)
+		}
+		t.Run(name, func(t *testing.T) {
+			tiers := tc.tiers
+			if tiers[0].Name != "region" {
+				tiers = append(DefaultTiers()[:1], tiers...)
+			}
+			l := &LocalityChecker{
+				Prefix:              "aws-",
+				MissingLabelsPolicy: tc.policy,
+				Tiers:               tiers,
+				Sources:             tc.sources,
+			}
+			info, err := l.getNodeLocalityInfo(context.Background(), node)
+			var got string
+			switch {
+			case err != nil:
+				got = "error"
+			case info != nil:
+				got = info.output().Flag()
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
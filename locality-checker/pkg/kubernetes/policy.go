@@ -0,0 +1,33 @@
+package kubernetes
+
+import (
+	"github.com/pkg/errors"
+)
+
+// MissingLabelsPolicy decides what happens when a required tier has no value.
+type MissingLabelsPolicy string
+
+const (
+	// MissingLabelsSkip writes no locality at all. CockroachDB then starts
+	// without --locality.
+	MissingLabelsSkip MissingLabelsPolicy = "skip"
+	// MissingLabelsFail returns an error.
+	MissingLabelsFail MissingLabelsPolicy = "fail"
+	// MissingLabelsDefault uses the tier's default, or DefaultLocalityValue if
+	// it has none.
+	MissingLabelsDefault MissingLabelsPolicy = "default"
+)
+
+// DefaultLocalityValue is the value of required tiers without a default under
+// the MissingLabelsDefault policy.
+const DefaultLocalityValue = "unknown"
+
+// ParseMissingLabelsPolicy parses a MissingLabelsPolicy.
+func ParseMissingLabelsPolicy(s string) (MissingLabelsPolicy, error) {
+	switch p := MissingLabelsPolicy(s); p {
+	case MissingLabelsSkip, MissingLabelsFail, MissingLabelsDefault:
+		return p, nil
+	default:
+		return "", errors.Errorf("unknown missing labels policy %q. Valid policies are \"skip\", \"fail\", \"default\"", s)
+	}
+}
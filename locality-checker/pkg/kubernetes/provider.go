@@ -0,0 +1,36 @@
+package kubernetes
+
+import (
+	"strings"
+)
+
+// providerNames maps the scheme of a node's spec.providerID to the name of the
+// cloud provider used in locality values.
+var providerNames = map[string]string{
+	"aws":          "aws",
+	"gce":          "gcp",
+	"azure":        "azure",
+	"digitalocean": "digitalocean",
+	"ibm":          "ibm",
+	"oci":          "oci",
+	"linode":       "linode",
+	"hcloud":       "hcloud",
+	"openstack":    "openstack",
+	"vsphere":      "vsphere",
+	"equinixmetal": "equinixmetal",
+	"packet":       "equinixmetal",
+	"exoscale":     "exoscale",
+	"kind":         "kind",
+}
+
+// ParseProviderID returns the cloud provider a node runs on from its
+// spec.providerID, e.g. "aws" for "aws:///us-east-1a/i-0123456789". It
+// returns false if the ID is empty or its scheme is unknown.
+func ParseProviderID(providerID string) (string, bool) {
+	i := strings.Index(providerID, "://")
+	if i <= 0 {
+		return "", false
+	}
+	name, ok := providerNames[strings.ToLower(providerID[:i])]
+	return name, ok
+}
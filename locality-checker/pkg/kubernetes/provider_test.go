@@ -0,0 +1,32 @@
+package kubernetes
+
+import "testing"
+
+func TestParseProviderID(t *testing.T) {
+	testCases := []struct {
+		providerID string
+		want       string
+		wantOK     bool
+	}{
+		{providerID: "aws:///us-east-1a/i-0123456789", want: "aws", wantOK: true},
+		{providerID: "gce://project/us-east1-b/instance-1", want: "gcp", wantOK: true},
+		{
+			providerID: "azure:///subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm",
+			want:       "azure",
+			wantOK:     true,
+		},
+		{providerID: "packet://1234", want: "equinixmetal", wantOK: true},
+		{providerID: "AWS:///us-east-1a/i-0123456789", want: "aws", wantOK: true},
+		{providerID: "kind://docker/kind/kind-worker", want: "kind", wantOK: true},
+		{providerID: ""},
+		{providerID: "i-0123456789"},
+		{providerID: "://us-east-1a/i-0123456789"},
+		{providerID: "unknown://instance"},
+	}
+	for _, tc := range testCases {
+		got, ok := ParseProviderID(tc.providerID)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("ParseProviderID(%q) = %q, %t, want %q, %t", tc.providerID, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package kubernetes
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/cockroachdb/k8s/locality-checker/pkg/metadata"
+	"github.com/pkg/errors"
+)
+
+// Source is a place tier values are looked up.
+type Source string
+
+const (
+	// SourceLabels reads tier values from the node's labels.
+	SourceLabels Source = "labels"
+	// SourceMetadata reads the region and zone tiers from the cloud provider's
+	// instance metadata service.
+	SourceMetadata Source = "metadata"
+	// SourceDefault uses the tier's default value.
+	SourceDefault Source = "default"
+)
+
+// DefaultSources is the order sources are consulted in when none is configured.
+var DefaultSources = []Source{SourceLabels, SourceMetadata, SourceDefault}
+
+// ParseSources parses a comma-separated list of sources.
+func ParseSources(s string) ([]Source, error) {
+	var sources []Source
+	for _, name := range strings.Split(s, ",") {
+		switch source := Source(name); source {
+		case SourceLabels, SourceMetadata, SourceDefault:
+			sources = append(sources, source)
+		default:
+			return nil, errors.Errorf("unknown source %q. Valid sources are \"labels\", \"metadata\", \"default\"", name)
+		}
+	}
+	return sources, nil
+}
+
+// tierResolver looks up tier values from the configured sources. The metadata
+// service is queried at most once, and only if a tier needs it.
+type tierResolver struct {
+	l      *LocalityChecker
+	labels map[string]string
+
+	metadataQueried bool
+	metadata        *metadata.Locality
+}
+
+// value returns the tier's value from the first source which has one, and
+// that source.
+func (r *tierResolver) value(ctx context.Context, tier Tier) (string, Source) {
+	for _, source := range r.l.sources() {
+		var value string
+		switch source {
+		case SourceLabels:
+			value, _ = getFirstValue(r.labels, tier.Labels)
+		case SourceMetadata:
+			value = r.metadataValue(ctx, tier)
+		case SourceDefault:
+			value = tier.Default
+		}
+		if value != "" {
+			return value, source
+		}
+	}
+	return "", ""
+}
+
+func (r *tierResolver) metadataValue(ctx context.Context, tier Tier) string {
+	if tier.Name != "region" && tier.Name != "zone" {
+		return ""
+	}
+	if !r.metadataQueried && len(r.l.MetadataProviders) > 0 {
+		r.metadataQueried = true
+		loc, err := metadata.FirstLocality(ctx, r.l.MetadataProviders)
+		if err != nil {
+			log.Printf("error querying instance metadata: %v", err)
+		}
+		r.metadata = loc
+	}
+	if r.metadata == nil {
+		return ""
+	}
+	if tier.Name == "region" {
+		return r.metadata.Region
+	}
+	return r.metadata.Zone
+}
@@ -0,0 +1,130 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Tier describes a single level of the locality hierarchy, e.g. region, zone
+// or rack, and the node labels its value is read from.
+type Tier struct {
+	// The name of the tier. Used as the name of the file the value is written
+	// to, and as the key in the locality flag unless LocalityKey is set.
+	Name string
+
+	// The key used for this tier in the combined locality flag. Defaults to Name.
+	LocalityKey string
+
+	// The node label keys to read the value from, in order of preference.
+	Labels []string
+
+	// Whether the tier must be present for locality information to be written.
+	Required bool
+
+	// The value to use if none of the other sources has one. Empty means the
+	// tier has no default.
+	Default string
+
+	// Whether the LocalityChecker's prefix is prepended to the value.
+	Prefixed bool
+}
+
+// RegionLabels are the node labels the region is read from by default.
+var RegionLabels = []string{
+	"topology.kubernetes.io/region",
+	"failure-domain.beta.kubernetes.io/region",
+}
+
+// ZoneLabels are the node labels the zone is read from by default.
+var ZoneLabels = []string{
+	"topology.kubernetes.io/zone",
+	"failure-domain.beta.kubernetes.io/zone",
+}
+
+// DefaultTiers returns the tiers used when none are configured: a region and
+// a zone, written to the locality flag as region and az.
+func DefaultTiers() []Tier {
+	return []Tier{
+		{
+			Name:     "region",
+			Labels:   RegionLabels,
+			Required: true,
+			Prefixed: true,
+		},
+		{
+			Name:        "zone",
+			LocalityKey: "az",
+			Labels:      ZoneLabels,
+			Required:    true,
+			Prefixed:    true,
+		},
+	}
+}
+
+func (t Tier) localityKey() string {
+	if t.LocalityKey != "" {
+		return t.LocalityKey
+	}
+	return t.Name
+}
+
+// ParseTier parses a tier from its flag representation:
+//
+//	<name>:<label>[,<label>...][:<option>[,<option>...]]
+//
+// Valid options are "required", "optional", "prefixed", "key=<locality key>"
+// and "default=<value>". Tiers are optional unless "required" is given.
+func ParseTier(s string) (Tier, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return Tier{}, errors.Errorf("invalid tier %q: expected <name>:<labels>[:<options>]", s)
+	}
+	t := Tier{
+		Name:   parts[0],
+		Labels: strings.Split(parts[1], ","),
+	}
+	if len(parts) < 3 || parts[2] == "" {
+		return t, nil
+	}
+	for _, opt := range strings.Split(parts[2], ",") {
+		switch {
+		case opt == "required":
+			t.Required = true
+		case opt == "optional":
+			t.Required = false
+		case opt == "prefixed":
+			t.Prefixed = true
+		case strings.HasPrefix(opt, "key="):
+			t.LocalityKey = strings.TrimPrefix(opt, "key=")
+		case strings.HasPrefix(opt, "default="):
+			t.Default = strings.TrimPrefix(opt, "default=")
+		default:
+			return Tier{}, errors.Errorf("invalid tier %q: unknown option %q", s, opt)
+		}
+	}
+	return t, nil
+}
+
+// String returns the flag representation of the tier.
+func (t Tier) String() string {
+	var opts []string
+	if t.Required {
+		opts = append(opts, "required")
+	}
+	if t.Prefixed {
+		opts = append(opts, "prefixed")
+	}
+	if t.LocalityKey != "" {
+		opts = append(opts, "key="+t.LocalityKey)
+	}
+	if t.Default != "" {
+		opts = append(opts, "default="+t.Default)
+	}
+	s := fmt.Sprintf("%s:%s", t.Name, strings.Join(t.Labels, ","))
+	if len(opts) > 0 {
+		s += ":" + strings.Join(opts, ",")
+	}
+	return s
+}
@@ -0,0 +1,80 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTier(t *testing.T) {
+	testCases := []struct {
+		flag    string
+		want    Tier
+		wantErr bool
+	}{
+		{
+			flag: "rack:example.com/rack",
+			want: Tier{Name: "rack", Labels: []string{"example.com/rack"}},
+		},
+		{
+			flag: "rack:example.com/rack:",
+			want: Tier{Name: "rack", Labels: []string{"example.com/rack"}},
+		},
+		{
+			flag: "zone:topology.kubernetes.io/zone,failure-domain.beta.kubernetes.io/zone:required,prefixed,key=az",
+			want: Tier{
+				Name:        "zone",
+				LocalityKey: "az",
+				Labels:      []string{"topology.kubernetes.io/zone", "failure-domain.beta.kubernetes.io/zone"},
+				Required:    true,
+				Prefixed:    true,
+			},
+		},
+		{
+			flag: "rack:example.com/rack:required,optional,default=rack-0",
+			want: Tier{Name: "rack", Labels: []string{"example.com/rack"}, Default: "rack-0"},
+		},
+		{
+			// Only the first two colons separate the parts.
+			flag: "host:example.com/host:default=a:b",
+			want: Tier{Name: "host", Labels: []string{"example.com/host"}, Default: "a:b"},
+		},
+		{flag: "rack", wantErr: true},
+		{flag: "rack:", wantErr: true},
+		{flag: ":example.com/rack", wantErr: true},
+		{flag: "rack:example.com/rack:unknown", wantErr: true},
+		{flag: "rack:example.com/rack:Required", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.flag, func(t *testing.T) {
+			got, err := ParseTier(tc.flag)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTierString(t *testing.T) {
+	// String returns a flag which parses back to the same tier.
+	for _, tier := range append(DefaultTiers(),
+		Tier{Name: "rack", Labels: []string{"example.com/rack"}},
+		Tier{Name: "rack", Labels: []string{"example.com/rack"}, Required: true, Default: "rack-0"},
+	) {
+		got, err := ParseTier(tier.String())
+		if err != nil {
+			t.Fatalf("%s: %v", tier, err)
+		}
+		if !reflect.DeepEqual(got, tier) {
+			t.Errorf("%s parsed as %+v, want %+v", tier, got, tier)
+		}
+	}
+}
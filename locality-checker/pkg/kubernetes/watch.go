@@ -0,0 +1,63 @@
+package kubernetes
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Watch keeps the locality files in sync with the node's labels until ctx is
+// done. Errors while writing are logged and retried on the next change or
+// resync, and Ready reports false until complete locality has been written.
+func (l *LocalityChecker) Watch(ctx context.Context, resync time.Duration) error {
+	selector := fields.OneTermEqualSelector("metadata.name", l.NodeName).String()
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = selector
+			return l.Clientset.CoreV1().Nodes().List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = selector
+			return l.Clientset.CoreV1().Nodes().Watch(ctx, options)
+		},
+	}
+
+	var last *corev1.Node
+	update := func(obj interface{}) {
+		node, ok := obj.(*corev1.Node)
+		if !ok {
+			return
+		}
+		if last != nil && l.Ready() &&
+			reflect.DeepEqual(last.Labels, node.Labels) &&
+			last.Spec.ProviderID == node.Spec.ProviderID {
+			return
+		}
+		last = node
+		if err := l.writeNodeLocality(ctx, node); err != nil {
+			log.Printf("error writing locality: %v", err)
+		} else if l.Ready() {
+			log.Printf("wrote locality for node %s", node.Name)
+		}
+	}
+
+	_, informer := cache.NewInformer(lw, &corev1.Node{}, resync, cache.ResourceEventHandlerFuncs{
+		AddFunc: update,
+		UpdateFunc: func(_, obj interface{}) {
+			update(obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			log.Printf("node %s was deleted", l.NodeName)
+		},
+	})
+	informer.Run(ctx.Done())
+	return ctx.Err()
+}
@@ -0,0 +1,90 @@
+package kubernetes
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testNode(labels map[string]string) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: labels}}
+}
+
+// readLocality returns the contents of the locality flag file, or "" if it
+// hasn't been written.
+func readLocality(t *testing.T, dir string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join(dir, "locality"))
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// waitFor polls cond until it is true, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	client := fake.NewSimpleClientset(testNode(map[string]string{
+		"topology.kubernetes.io/region": "us-east-1",
+		"topology.kubernetes.io/zone":   "us-east-1a",
+	}))
+	dir := t.TempDir()
+	l := &LocalityChecker{Clientset: client, NodeName: "node-1", WritePath: dir}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- l.Watch(ctx, time.Hour)
+	}()
+
+	waitFor(t, "the initial locality", func() bool {
+		return l.Ready() && readLocality(t, dir) == "--locality=region=us-east-1,az=us-east-1a"
+	})
+
+	// Label changes are written.
+	node := testNode(map[string]string{
+		"topology.kubernetes.io/region": "us-east-1",
+		"topology.kubernetes.io/zone":   "us-east-1b",
+	})
+	if _, err := client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the new zone", func() bool {
+		return l.Ready() && readLocality(t, dir) == "--locality=region=us-east-1,az=us-east-1b"
+	})
+
+	// Losing a required label leaves the last locality in place, but the
+	// checker is no longer ready.
+	node = testNode(map[string]string{"topology.kubernetes.io/region": "us-east-1"})
+	if _, err := client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the checker to become unready", func() bool { return !l.Ready() })
+	if got := readLocality(t, dir); got != "--locality=region=us-east-1,az=us-east-1b" {
+		t.Errorf("locality is %q after losing the zone label", got)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Watch returned %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch didn't return after the context was canceled")
+	}
+}
@@ -0,0 +1,56 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// DefaultAWSEndpoint is the address of the EC2 instance metadata service.
+const DefaultAWSEndpoint = "http://169.254.169.254"
+
+// AWS reads the locality from the EC2 instance metadata service, using an
+// IMDSv2 session token.
+type AWS struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+func (a *AWS) Name() string {
+	return "aws"
+}
+
+func (a *AWS) Locality(ctx context.Context) (*Locality, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, a.Endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, err := get(a.Client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := a.get(ctx, string(token), "/latest/meta-data/placement/region")
+	if err != nil {
+		return nil, err
+	}
+	zone, err := a.get(ctx, string(token), "/latest/meta-data/placement/availability-zone")
+	if err != nil {
+		return nil, err
+	}
+	return &Locality{Region: region, Zone: zone}, nil
+}
+
+func (a *AWS) get(ctx context.Context, token string, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.Endpoint+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+	body, err := get(a.Client, req)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
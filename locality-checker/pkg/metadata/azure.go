@@ -0,0 +1,55 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultAzureEndpoint is the address of the Azure instance metadata service.
+const DefaultAzureEndpoint = "http://169.254.169.254"
+
+// Azure reads the locality from the Azure instance metadata service.
+type Azure struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+func (a *Azure) Name() string {
+	return "azure"
+}
+
+func (a *Azure) Locality(ctx context.Context) (*Locality, error) {
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodGet, a.Endpoint+"/metadata/instance/compute?api-version=2021-02-01", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+	body, err := get(a.Client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var compute struct {
+		Location string `json:"location"`
+		Zone     string `json:"zone"`
+	}
+	if err := json.Unmarshal(body, &compute); err != nil {
+		return nil, errors.Wrap(err, "decoding Azure instance metadata failed")
+	}
+	if compute.Location == "" {
+		return nil, errors.New("Azure instance metadata has no location")
+	}
+
+	// Match the topology.kubernetes.io/zone label set by the Azure cloud
+	// provider, which is <location>-<zone>. VMs which aren't in an
+	// availability zone report an empty zone.
+	loc := &Locality{Region: compute.Location}
+	if compute.Zone != "" {
+		loc.Zone = compute.Location + "-" + compute.Zone
+	}
+	return loc, nil
+}
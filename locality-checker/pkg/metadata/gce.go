@@ -0,0 +1,45 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultGCEEndpoint is the address of the GCE metadata server.
+const DefaultGCEEndpoint = "http://metadata.google.internal"
+
+// GCE reads the locality from the GCE metadata server.
+type GCE struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+func (g *GCE) Name() string {
+	return "gce"
+}
+
+func (g *GCE) Locality(ctx context.Context) (*Locality, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.Endpoint+"/computeMetadata/v1/instance/zone", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	body, err := get(g.Client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The zone is returned as projects/<project number>/zones/<zone>, and the
+	// region is the zone without its last component, e.g. us-east1-b is in
+	// us-east1.
+	zone := path.Base(strings.TrimSpace(string(body)))
+	i := strings.LastIndex(zone, "-")
+	if i <= 0 {
+		return nil, errors.Errorf("unexpected GCE zone %q", zone)
+	}
+	return &Locality{Region: zone[:i], Zone: zone}, nil
+}
@@ -0,0 +1,84 @@
+// Package metadata looks up the region and zone of the machine the process is
+// running on from cloud provider instance metadata services.
+package metadata
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Locality is the region and zone reported by a metadata service.
+type Locality struct {
+	Region string
+	Zone   string
+}
+
+// Provider queries a single cloud provider's metadata service.
+type Provider interface {
+	// Name returns the name of the provider, e.g. "aws".
+	Name() string
+
+	// Locality returns the region and zone of the current instance.
+	Locality(ctx context.Context) (*Locality, error)
+}
+
+// NewProvider returns the provider with the given name. If endpoint is
+// non-empty, it replaces the provider's default metadata service address,
+// which is useful for testing against a local stand-in.
+func NewProvider(name string, endpoint string, client *http.Client) (Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	switch name {
+	case "aws":
+		return &AWS{Endpoint: endpointOrDefault(endpoint, DefaultAWSEndpoint), Client: client}, nil
+	case "gce":
+		return &GCE{Endpoint: endpointOrDefault(endpoint, DefaultGCEEndpoint), Client: client}, nil
+	case "azure":
+		return &Azure{Endpoint: endpointOrDefault(endpoint, DefaultAzureEndpoint), Client: client}, nil
+	default:
+		return nil, errors.Errorf("unknown metadata provider %q. Valid providers are \"aws\", \"gce\", \"azure\"", name)
+	}
+}
+
+// FirstLocality queries the providers in order and returns the locality from
+// the first one which answers.
+func FirstLocality(ctx context.Context, providers []Provider) (*Locality, error) {
+	var errs []string
+	for _, p := range providers {
+		loc, err := p.Locality(ctx)
+		if err == nil {
+			return loc, nil
+		}
+		errs = append(errs, p.Name()+": "+err.Error())
+	}
+	return nil, errors.Errorf("no metadata provider answered: [%s]", strings.Join(errs, "; "))
+}
+
+func endpointOrDefault(endpoint string, def string) string {
+	if endpoint == "" {
+		return def
+	}
+	return strings.TrimSuffix(endpoint, "/")
+}
+
+// get sends req and returns the response body, failing on non-2xx responses.
+func get(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading response of %s %s failed", req.Method, req.URL)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.Errorf("%s %s returned %s", req.Method, req.URL, resp.Status)
+	}
+	return body, nil
+}
@@ -0,0 +1,181 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newProvider(t *testing.T, name string, handler http.HandlerFunc) Provider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	p, err := NewProvider(name, server.URL+"/", server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestAWS(t *testing.T) {
+	const token = "session-token"
+	p := newProvider(t, "aws", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != http.MethodPut || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				http.Error(w, "bad token request", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(token))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != token {
+			http.Error(w, "missing token", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/placement/region":
+			w.Write([]byte("us-east-1\n"))
+		case "/latest/meta-data/placement/availability-zone":
+			w.Write([]byte("us-east-1a"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	loc, err := p.Locality(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Locality{Region: "us-east-1", Zone: "us-east-1a"}); *loc != want {
+		t.Errorf("got %+v, want %+v", *loc, want)
+	}
+}
+
+func TestAWSTokenRejected(t *testing.T) {
+	p := newProvider(t, "aws", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+	if loc, err := p.Locality(context.Background()); err == nil {
+		t.Errorf("expected an error, got %+v", *loc)
+	}
+}
+
+func TestGCE(t *testing.T) {
+	testCases := []struct {
+		zone    string
+		want    Locality
+		wantErr bool
+	}{
+		{zone: "projects/123456/zones/us-east1-b", want: Locality{Region: "us-east1", Zone: "us-east1-b"}},
+		{zone: "projects/123456/zones/europe-west4-a\n", want: Locality{Region: "europe-west4", Zone: "europe-west4-a"}},
+		{zone: "projects/123456/zones/nozone", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.zone, func(t *testing.T) {
+			p := newProvider(t, "gce", func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Metadata-Flavor") != "Google" {
+					http.Error(w, "missing Metadata-Flavor", http.StatusForbidden)
+					return
+				}
+				if r.URL.Path != "/computeMetadata/v1/instance/zone" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Write([]byte(tc.zone))
+			})
+			loc, err := p.Locality(context.Background())
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", *loc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *loc != tc.want {
+				t.Errorf("got %+v, want %+v", *loc, tc.want)
+			}
+		})
+	}
+}
+
+func TestAzure(t *testing.T) {
+	testCases := []struct {
+		name    string
+		compute string
+		want    Locality
+		wantErr bool
+	}{
+		{
+			name:    "zonal",
+			compute: `{"location": "eastus", "zone": "2"}`,
+			want:    Locality{Region: "eastus", Zone: "eastus-2"},
+		},
+		{
+			name:    "no zone",
+			compute: `{"location": "westeurope", "zone": ""}`,
+			want:    Locality{Region: "westeurope"},
+		},
+		{
+			name:    "no location",
+			compute: `{"zone": "1"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid",
+			compute: `not json`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newProvider(t, "azure", func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Metadata") != "true" {
+					http.Error(w, "missing Metadata header", http.StatusBadRequest)
+					return
+				}
+				if r.URL.Path != "/metadata/instance/compute" || r.URL.Query().Get("api-version") == "" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Write([]byte(tc.compute))
+			})
+			loc, err := p.Locality(context.Background())
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %+v", *loc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *loc != tc.want {
+				t.Errorf("got %+v, want %+v", *loc, tc.want)
+			}
+		})
+	}
+}
+
+func TestFirstLocality(t *testing.T) {
+	failing := newProvider(t, "aws", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	gce := newProvider(t, "gce", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("projects/1/zones/us-central1-c"))
+	})
+
+	loc, err := FirstLocality(context.Background(), []Provider{failing, gce})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Locality{Region: "us-central1", Zone: "us-central1-c"}); *loc != want {
+		t.Errorf("got %+v, want %+v", *loc, want)
+	}
+
+	if _, err := FirstLocality(context.Background(), []Provider{failing}); err == nil {
+		t.Error("expected an error when no provider answers")
+	}
+}
@@ -0,0 +1,218 @@
+// Package multiregion generates the SQL configuring a CockroachDB database for
+// the regions and zones its nodes run in.
+package multiregion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SurvivalGoal is the failure a database is configured to survive.
+type SurvivalGoal string
+
+const (
+	// SurviveZoneFailure keeps the database available if a zone fails.
+	SurviveZoneFailure SurvivalGoal = "zone"
+	// SurviveRegionFailure keeps the database available if a region fails.
+	SurviveRegionFailure SurvivalGoal = "region"
+)
+
+// minFailureDomains is the number of failure domains needed to survive the
+// loss of one of them while keeping a majority of replicas.
+const minFailureDomains = 3
+
+// Zone is a zone CockroachDB nodes run in.
+type Zone struct {
+	Name string
+	// The number of CockroachDB nodes in the zone.
+	Nodes int
+}
+
+// Region is a region CockroachDB nodes run in.
+type Region struct {
+	Name  string
+	Zones []Zone
+}
+
+// Nodes returns the number of CockroachDB nodes in the region.
+func (r Region) Nodes() int {
+	var n int
+	for _, z := range r.Zones {
+		n += z.Nodes
+	}
+	return n
+}
+
+// Topology is the set of regions and zones CockroachDB nodes run in.
+type Topology struct {
+	// The locality keys of the region and zone tiers, e.g. "region" and "az".
+	RegionKey string
+	ZoneKey   string
+
+	Regions []Region
+}
+
+// AddNode records a CockroachDB node in the given region and zone.
+func (t *Topology) AddNode(region string, zone string) {
+	for i := range t.Regions {
+		if t.Regions[i].Name != region {
+			continue
+		}
+		for j := range t.Regions[i].Zones {
+			if t.Regions[i].Zones[j].Name == zone {
+				t.Regions[i].Zones[j].Nodes++
+				return
+			}
+		}
+		t.Regions[i].Zones = append(t.Regions[i].Zones, Zone{Name: zone, Nodes: 1})
+		sort.Slice(t.Regions[i].Zones, func(a, b int) bool {
+			return t.Regions[i].Zones[a].Name < t.Regions[i].Zones[b].Name
+		})
+		return
+	}
+	t.Regions = append(t.Regions, Region{Name: region, Zones: []Zone{{Name: zone, Nodes: 1}}})
+	sort.Slice(t.Regions, func(a, b int) bool { return t.Regions[a].Name < t.Regions[b].Name })
+}
+
+func (t *Topology) region(name string) (Region, bool) {
+	for _, r := range t.Regions {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Region{}, false
+}
+
+// Options configure the generated SQL.
+type Options struct {
+	// The database to configure.
+	Database string
+
+	// The primary region. Defaults to the region with the most nodes.
+	PrimaryRegion string
+
+	// The failure the database should survive.
+	SurvivalGoal SurvivalGoal
+
+	// Whether to also emit a CONFIGURE ZONE statement for each region, spreading
+	// the voting replicas of the region's REGIONAL tables over its zones. This
+	// uses zone config extensions, added in CockroachDB v22.1.
+	ZoneConfigs bool
+}
+
+// Validate checks that the topology can support the survival goal.
+func Validate(t *Topology, opts Options) error {
+	if len(t.Regions) == 0 {
+		return errors.New("no regions found")
+	}
+	switch opts.SurvivalGoal {
+	case SurviveZoneFailure:
+		primary, ok := t.region(primaryRegion(t, opts))
+		if !ok {
+			return errors.Errorf("primary region %q has no CockroachDB nodes", opts.PrimaryRegion)
+		}
+		if len(primary.Zones) < minFailureDomains {
+			return errors.Errorf("ZONE survival requires at least %d zones in the primary region, but %s has %d",
+				minFailureDomains, primary.Name, len(primary.Zones))
+		}
+	case SurviveRegionFailure:
+		if len(t.Regions) < minFailureDomains {
+			return errors.Errorf("REGION survival requires at least %d regions, but only %d were found",
+				minFailureDomains, len(t.Regions))
+		}
+		if _, ok := t.region(primaryRegion(t, opts)); !ok {
+			return errors.Errorf("primary region %q has no CockroachDB nodes", opts.PrimaryRegion)
+		}
+	default:
+		return errors.Errorf("unknown survival goal %q. Valid goals are \"zone\", \"region\"", opts.SurvivalGoal)
+	}
+	return nil
+}
+
+// Generate validates the topology against the survival goal and returns the
+// SQL configuring the database for it.
+func Generate(t *Topology, opts Options) (string, error) {
+	if opts.Database == "" {
+		return "", errors.New("a database is required")
+	}
+	if err := Validate(t, opts); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	db := quoteIdent(opts.Database)
+	primary := primaryRegion(t, opts)
+	fmt.Fprintf(&buf, "ALTER DATABASE %s PRIMARY REGION %s;\n", db, quoteIdent(primary))
+	for _, r := range t.Regions {
+		if r.Name != primary {
+			fmt.Fprintf(&buf, "ALTER DATABASE %s ADD REGION %s;\n", db, quoteIdent(r.Name))
+		}
+	}
+	fmt.Fprintf(&buf, "ALTER DATABASE %s SURVIVE %s FAILURE;\n", db, strings.ToUpper(string(opts.SurvivalGoal)))
+
+	if opts.ZoneConfigs {
+		for _, r := range t.Regions {
+			constraints, err := voterConstraints(t, r, opts.SurvivalGoal)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&buf, "ALTER DATABASE %s ALTER LOCALITY REGIONAL IN %s CONFIGURE ZONE USING voter_constraints = %s;\n",
+				db, quoteIdent(r.Name), quoteString(constraints))
+		}
+	}
+	return buf.String(), nil
+}
+
+// homeVoters returns the number of voting replicas CockroachDB places in the
+// home region of a REGIONAL table for the survival goal.
+func homeVoters(goal SurvivalGoal) int {
+	if goal == SurviveRegionFailure {
+		return 2
+	}
+	return minFailureDomains
+}
+
+// voterConstraints returns per-replica constraints placing the home region's
+// voting replicas in distinct zones of the region r.
+func voterConstraints(t *Topology, r Region, goal SurvivalGoal) (string, error) {
+	constraints := make(map[string]int)
+	for i, z := range r.Zones {
+		if i == homeVoters(goal) {
+			break
+		}
+		constraints[fmt.Sprintf("+%s=%s,+%s=%s", t.RegionKey, r.Name, t.ZoneKey, z.Name)] = 1
+	}
+	b, err := json.Marshal(constraints)
+	if err != nil {
+		return "", errors.Wrap(err, "encoding zone constraints failed")
+	}
+	return string(b), nil
+}
+
+// primaryRegion returns the configured primary region, or the region with the
+// most nodes.
+func primaryRegion(t *Topology, opts Options) string {
+	if opts.PrimaryRegion != "" {
+		return opts.PrimaryRegion
+	}
+	var primary Region
+	for _, r := range t.Regions {
+		if r.Nodes() > primary.Nodes() {
+			primary = r
+		}
+	}
+	return primary.Name
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,153 @@
+package multiregion
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// topology returns a topology with a node in each of the given region/zone
+// pairs.
+func topology(nodes ...[2]string) *Topology {
+	t := &Topology{RegionKey: "region", ZoneKey: "az"}
+	for _, n := range nodes {
+		t.AddNode(n[0], n[1])
+	}
+	return t
+}
+
+func TestValidate(t *testing.T) {
+	threeZones := topology(
+		[2]string{"us-east1", "us-east1-b"},
+		[2]string{"us-east1", "us-east1-c"},
+		[2]string{"us-east1", "us-east1-d"},
+		[2]string{"us-west1", "us-west1-a"},
+	)
+	threeRegions := topology(
+		[2]string{"us-east1", "us-east1-b"},
+		[2]string{"us-west1", "us-west1-a"},
+		[2]string{"europe-west1", "europe-west1-b"},
+	)
+	testCases := []struct {
+		name     string
+		topology *Topology
+		opts     Options
+		wantErr  bool
+	}{
+		{name: "no regions", topology: topology(), opts: Options{SurvivalGoal: SurviveZoneFailure}, wantErr: true},
+		{name: "unknown goal", topology: threeZones, opts: Options{SurvivalGoal: "node"}, wantErr: true},
+		{name: "zone", topology: threeZones, opts: Options{SurvivalGoal: SurviveZoneFailure}},
+		{
+			// The primary region needs three zones, whichever other region does.
+			name:     "zone with a small primary region",
+			topology: threeZones,
+			opts:     Options{SurvivalGoal: SurviveZoneFailure, PrimaryRegion: "us-west1"},
+			wantErr:  true,
+		},
+		{
+			name: "zone with two zones",
+			topology: topology(
+				[2]string{"us-east1", "us-east1-b"},
+				[2]string{"us-east1", "us-east1-b"},
+				[2]string{"us-east1", "us-east1-c"},
+			),
+			opts:    Options{SurvivalGoal: SurviveZoneFailure},
+			wantErr: true,
+		},
+		{
+			name:     "zone with an unknown primary region",
+			topology: threeZones,
+			opts:     Options{SurvivalGoal: SurviveZoneFailure, PrimaryRegion: "asia-east1"},
+			wantErr:  true,
+		},
+		{name: "region", topology: threeRegions, opts: Options{SurvivalGoal: SurviveRegionFailure}},
+		{
+			name:     "region with a primary region",
+			topology: threeRegions,
+			opts:     Options{SurvivalGoal: SurviveRegionFailure, PrimaryRegion: "europe-west1"},
+		},
+		{name: "region with two regions", topology: threeZones, opts: Options{SurvivalGoal: SurviveRegionFailure}, wantErr: true},
+		{
+			name:     "region with an unknown primary region",
+			topology: threeRegions,
+			opts:     Options{SurvivalGoal: SurviveRegionFailure, PrimaryRegion: "asia-east1"},
+			wantErr:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Validate(tc.topology, tc.opts)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("got %v, want error: %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	// us-west1 has the most nodes, and so is the default primary region.
+	topo := topology(
+		[2]string{"us-east1", "us-east1-b"},
+		[2]string{"us-east1", "us-east1-c"},
+		[2]string{"us-east1", "us-east1-d"},
+		[2]string{"us-west1", "us-west1-a"},
+		[2]string{"us-west1", "us-west1-a"},
+		[2]string{"us-west1", "us-west1-b"},
+		[2]string{"us-west1", "us-west1-c"},
+		[2]string{"us-west1", "us-west1-d"},
+		[2]string{"europe-west1", "europe-west1-b"},
+	)
+	testCases := []struct {
+		golden string
+		opts   Options
+	}{
+		{golden: "zone", opts: Options{SurvivalGoal: SurviveZoneFailure}},
+		{golden: "zone-configs", opts: Options{SurvivalGoal: SurviveZoneFailure, ZoneConfigs: true}},
+		{golden: "region", opts: Options{SurvivalGoal: SurviveRegionFailure, PrimaryRegion: "us-east1"}},
+		{
+			golden: "region-zone-configs",
+			opts:   Options{SurvivalGoal: SurviveRegionFailure, PrimaryRegion: "us-east1", ZoneConfigs: true},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.golden, func(t *testing.T) {
+			tc.opts.Database = `my"db`
+			got, err := Generate(topo, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", tc.golden+".golden")
+			if *update {
+				if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestGenerateInvalid(t *testing.T) {
+	topo := topology([2]string{"us-east1", "us-east1-b"})
+	if _, err := Generate(topo, Options{Database: "db", SurvivalGoal: SurviveZoneFailure}); err == nil {
+		t.Error("expected an error for a topology which can't survive a zone failure")
+	}
+	topo = topology(
+		[2]string{"us-east1", "us-east1-b"},
+		[2]string{"us-east1", "us-east1-c"},
+		[2]string{"us-east1", "us-east1-d"},
+	)
+	if _, err := Generate(topo, Options{SurvivalGoal: SurviveZoneFailure}); err == nil {
+		t.Error("expected an error without a database")
+	}
+}
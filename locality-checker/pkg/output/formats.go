@@ -0,0 +1,137 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// Flag writes the locality as a --locality flag for `cockroach start`.
+type Flag struct {
+	Filename string
+}
+
+func (f *Flag) File() string {
+	return f.Filename
+}
+
+func (f *Flag) Render(l Locality) ([]byte, error) {
+	return []byte("--locality=" + l.Flag()), nil
+}
+
+// document is the structure written by the JSON and YAML outputs.
+type document struct {
+	Locality string `json:"locality"`
+	Tiers    []Tier `json:"tiers"`
+}
+
+func newDocument(l Locality) document {
+	tiers := l.Tiers
+	if tiers == nil {
+		tiers = []Tier{}
+	}
+	return document{Locality: l.Flag(), Tiers: tiers}
+}
+
+// JSON writes the locality as a JSON document.
+type JSON struct {
+	Filename string
+}
+
+func (j *JSON) File() string {
+	return j.Filename
+}
+
+func (j *JSON) Render(l Locality) ([]byte, error) {
+	b, err := json.MarshalIndent(newDocument(l), "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding locality as JSON failed")
+	}
+	return append(b, '\n'), nil
+}
+
+// YAML writes the locality as a YAML document.
+type YAML struct {
+	Filename string
+}
+
+func (y *YAML) File() string {
+	return y.Filename
+}
+
+func (y *YAML) Render(l Locality) ([]byte, error) {
+	b, err := yaml.Marshal(newDocument(l))
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding locality as YAML failed")
+	}
+	return b, nil
+}
+
+// Env writes the locality as a file which can be sourced by a shell. It sets
+// COCKROACH_LOCALITY to the locality flag value, and COCKROACH_LOCALITY_<NAME>
+// to the value of each tier.
+type Env struct {
+	Filename string
+}
+
+var nonEnvChars = regexp.MustCompile(`[^A-Z0-9_]`)
+
+func (e *Env) File() string {
+	return e.Filename
+}
+
+func (e *Env) Render(l Locality) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "COCKROACH_LOCALITY=%s\n", shellQuote(l.Flag()))
+	for _, t := range l.Tiers {
+		name := nonEnvChars.ReplaceAllString(strings.ToUpper(t.Name), "_")
+		fmt.Fprintf(&buf, "COCKROACH_LOCALITY_%s=%s\n", name, shellQuote(t.Value))
+	}
+	return buf.Bytes(), nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Template writes the locality using a text/template. The template is
+// executed with the Locality, so e.g. {{.Flag}}, {{range .Tiers}} and
+// {{.Values.region}} are available.
+type Template struct {
+	Filename string
+	Template *template.Template
+}
+
+// NewTemplate returns a Template output writing file from the template at
+// templatePath.
+func NewTemplate(file string, templatePath string) (*Template, error) {
+	text, err := ioutil.ReadFile(templatePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading template %s failed", templatePath)
+	}
+	tmpl, err := template.New(filepath.Base(templatePath)).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing template %s failed", templatePath)
+	}
+	return &Template{Filename: file, Template: tmpl}, nil
+}
+
+func (t *Template) File() string {
+	return t.Filename
+}
+
+func (t *Template) Render(l Locality) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := t.Template.Execute(&buf, l); err != nil {
+		return nil, errors.Wrapf(err, "executing template %s failed", t.Template.Name())
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,105 @@
+// Package output renders locality information into the files consumed by
+// CockroachDB and surrounding tooling.
+package output
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Tier is the value of a single locality tier.
+type Tier struct {
+	// The name of the tier, e.g. "zone".
+	Name string `json:"name"`
+	// The key of the tier in the locality flag, e.g. "az".
+	Key string `json:"key"`
+	// The value of the tier, e.g. "us-east1-b".
+	Value string `json:"value"`
+}
+
+// Locality is the locality information rendered by outputs.
+type Locality struct {
+	Tiers []Tier
+}
+
+// Flag returns the value of the --locality flag, e.g.
+// "region=us-east1,az=us-east1-b".
+func (l Locality) Flag() string {
+	var pairs []string
+	for _, t := range l.Tiers {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", t.Key, t.Value))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Values returns the tier values keyed by tier name.
+func (l Locality) Values() map[string]string {
+	values := make(map[string]string, len(l.Tiers))
+	for _, t := range l.Tiers {
+		values[t.Name] = t.Value
+	}
+	return values
+}
+
+// Output renders locality information into a file.
+type Output interface {
+	// File returns the name of the file written, relative to the destination
+	// directory.
+	File() string
+
+	// Render returns the contents of the file.
+	Render(l Locality) ([]byte, error)
+}
+
+// Parse parses an output from its flag representation:
+//
+//	<format>[,file=<name>][,template=<path>]
+//
+// Valid formats are "flag", "json", "yaml", "env" and "template". The
+// template format requires a template path.
+func Parse(s string) (Output, error) {
+	parts := strings.Split(s, ",")
+	format := parts[0]
+	var file, templatePath string
+	for _, opt := range parts[1:] {
+		switch {
+		case strings.HasPrefix(opt, "file="):
+			file = strings.TrimPrefix(opt, "file=")
+		case strings.HasPrefix(opt, "template="):
+			templatePath = strings.TrimPrefix(opt, "template=")
+		default:
+			return nil, errors.Errorf("invalid output %q: unknown option %q", s, opt)
+		}
+	}
+	if templatePath != "" && format != "template" {
+		return nil, errors.Errorf("invalid output %q: template is only valid for the template format", s)
+	}
+
+	switch format {
+	case "flag":
+		return &Flag{Filename: fileOrDefault(file, "locality")}, nil
+	case "json":
+		return &JSON{Filename: fileOrDefault(file, "locality.json")}, nil
+	case "yaml":
+		return &YAML{Filename: fileOrDefault(file, "locality.yaml")}, nil
+	case "env":
+		return &Env{Filename: fileOrDefault(file, "locality.env")}, nil
+	case "template":
+		if templatePath == "" || file == "" {
+			return nil, errors.Errorf("invalid output %q: the template format requires template=<path> and file=<name>", s)
+		}
+		return NewTemplate(file, templatePath)
+	default:
+		return nil, errors.Errorf("invalid output %q: unknown format %q. "+
+			"Valid formats are \"flag\", \"json\", \"yaml\", \"env\", \"template\"", s, format)
+	}
+}
+
+func fileOrDefault(file string, def string) string {
+	if file == "" {
+		return def
+	}
+	return file
+}
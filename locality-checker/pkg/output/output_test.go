@@ -0,0 +1,70 @@
+package output
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestRender(t *testing.T) {
+	tmpl, err := NewTemplate("locality.txt", filepath.Join("testdata", "locality.tmpl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := Locality{Tiers: []Tier{
+		{Name: "region", Key: "region", Value: "us-east1"},
+		{Name: "zone", Key: "az", Value: "us-east1-b"},
+		{Name: "data-center", Key: "dc", Value: "dc'1"},
+	}}
+	testCases := []struct {
+		golden string
+		output Output
+	}{
+		{golden: "flag", output: &Flag{Filename: "locality"}},
+		{golden: "json", output: &JSON{Filename: "locality.json"}},
+		{golden: "yaml", output: &YAML{Filename: "locality.yaml"}},
+		{golden: "env", output: &Env{Filename: "locality.env"}},
+		{golden: "template", output: tmpl},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.golden, func(t *testing.T) {
+			got, err := tc.output.Render(l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tc.golden, got)
+		})
+	}
+}
+
+func TestRenderNoTiers(t *testing.T) {
+	// An empty locality is written as an empty list of tiers, not null.
+	got, err := (&JSON{}).Render(Locality{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "json-no-tiers", got)
+}
+
+// checkGolden compares got to testdata/<name>.golden, rewriting the file
+// instead with -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/cockroachdb/k8s/locality-checker/pkg/kubernetes"
+	"github.com/cockroachdb/k8s/locality-checker/pkg/multiregion"
+)
+
+var sqlDatabase = flag.String("database", "", "sql: database to configure")
+var sqlPrimaryRegion = flag.String("primary-region", "", "sql: primary region of the database; defaults to the region with the most CockroachDB pods")
+var sqlSurvivalGoal = flag.String("survival-goal", "zone", "sql: failure the database should survive, zone or region")
+var sqlZoneConfigs = flag.Bool("zone-configs", false, "sql: also configure each region to place its voting replicas in distinct zones")
+
+// runSQL prints the multi-region SQL matching the regions and zones of the
+// nodes running CockroachDB pods.
+func runSQL(ctx context.Context, l *kubernetes.LocalityChecker) {
+	if *sqlDatabase == "" {
+		log.Fatal("--database is required and must not be empty")
+	}
+	a := &kubernetes.Auditor{
+		Checker:      l,
+		NodeSelector: *auditNodeSelector,
+		Namespace:    *auditNamespace,
+		PodSelector:  *auditPodSelector,
+	}
+	report, err := a.Audit(ctx)
+	if err != nil {
+		log.Fatalf("error auditing nodes: %v", err)
+	}
+	sql, err := multiregion.Generate(report.Topology(), multiregion.Options{
+		Database:      *sqlDatabase,
+		PrimaryRegion: *sqlPrimaryRegion,
+		SurvivalGoal:  multiregion.SurvivalGoal(*sqlSurvivalGoal),
+		ZoneConfigs:   *sqlZoneConfigs,
+	})
+	if err != nil {
+		log.Fatalf("error generating SQL: %v", err)
+	}
+	fmt.Print(sql)
+}
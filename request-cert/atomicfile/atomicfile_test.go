@@ -0,0 +1,148 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// listDir returns the names of the files in dir.
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "locality")
+	if err := ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A reader which opened the old file keeps reading it: the file is
+	// replaced rather than rewritten in place.
+	old, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+
+	if err := WriteFile(path, []byte("new"), Options{Mode: 0600}); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != "new" {
+		t.Errorf("got %q, %v, want %q", b, err, "new")
+	}
+	if b, err := ioutil.ReadAll(old); err != nil || string(b) != "old" {
+		t.Errorf("the previously opened file has %q, %v, want %q", b, err, "old")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("got mode %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+	if names := listDir(t, dir); !reflect.DeepEqual(names, []string{"locality"}) {
+		t.Errorf("got files %v, want only locality", names)
+	}
+}
+
+func TestWriteFileOwner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locality")
+	// Chown to the current owner is allowed without privileges.
+	owner := &Owner{UID: os.Getuid(), GID: os.Getgid()}
+	if err := WriteFile(path, []byte("data"), Options{Mode: 0644, Owner: owner}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteFileFailure(t *testing.T) {
+	dir := t.TempDir()
+	// The rename over a non-empty directory fails.
+	path := filepath.Join(dir, "locality")
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(path, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(path, []byte("data"), Options{Mode: 0644}); err == nil {
+		t.Fatal("expected an error")
+	}
+	// The temporary file is removed.
+	if names := listDir(t, dir); !reflect.DeepEqual(names, []string{"locality"}) {
+		t.Errorf("got files %v, want only locality", names)
+	}
+
+	if err := WriteFile(filepath.Join(dir, "missing", "locality"), []byte("data"), Options{Mode: 0644}); err == nil {
+		t.Error("expected an error writing to a missing directory")
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	testCases := []struct {
+		s       string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{s: "0644", want: 0644},
+		{s: "600", want: 0600},
+		{s: "0777", want: 0777},
+		{s: "1777", wantErr: true},
+		{s: "0689", wantErr: true},
+		{s: "rw-r--r--", wantErr: true},
+		{s: "", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := ParseMode(tc.s)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("ParseMode(%q) = %v, %v, want %v, error: %t", tc.s, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestParseOwner(t *testing.T) {
+	testCases := []struct {
+		s       string
+		want    *Owner
+		wantErr bool
+	}{
+		{s: ""},
+		{s: "1000:2000", want: &Owner{UID: 1000, GID: 2000}},
+		{s: "1000", wantErr: true},
+		{s: "1000:2000:3000", wantErr: true},
+		{s: "root:2000", wantErr: true},
+		{s: "1000:root", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := ParseOwner(tc.s)
+		if (err != nil) != tc.wantErr || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParseOwner(%q) = %+v, %v, want %+v, error: %t", tc.s, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
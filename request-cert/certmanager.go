@@ -0,0 +1,309 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	types "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+var (
+	issuerName  = flag.String("issuer-name", "", "with --signer=cert-manager, the name of the Issuer or ClusterIssuer")
+	issuerKind  = flag.String("issuer-kind", "Issuer", "with --signer=cert-manager, the kind of the issuer: Issuer or ClusterIssuer")
+	issuerGroup = flag.String("issuer-group", "cert-manager.io", "with --signer=cert-manager, the API group of the issuer")
+)
+
+// certificateRequests are cert-manager's CertificateRequest resources.
+var certificateRequests = schema.GroupVersionResource{
+	Group:    "cert-manager.io",
+	Version:  "v1",
+	Resource: "certificaterequests",
+}
+
+// certManagerSigner requests certificates through cert-manager
+// CertificateRequests, in --namespace and named after the CSR.
+type certManagerSigner struct {
+	client    dynamic.Interface
+	namespace string
+	issuerRef map[string]interface{}
+	duration  time.Duration
+	// The hostname of this pod, recorded in requesterAnnotation.
+	requester string
+
+	// The CA returned with the last certificate.
+	ca []byte
+}
+
+func newCertManagerSigner(
+	client dynamic.Interface, namespace string, issuerName string, issuerKind string, issuerGroup string,
+	duration time.Duration, requester string,
+) (*certManagerSigner, error) {
+	if issuerName == "" {
+		return nil, errors.Errorf("--signer=%s requires --issuer-name", signerCertManager)
+	}
+	if issuerKind != "Issuer" && issuerKind != "ClusterIssuer" {
+		return nil, errors.Errorf("unknown --issuer-kind=%q. Valid kinds are \"Issuer\", \"ClusterIssuer\"", issuerKind)
+	}
+	return &certManagerSigner{
+		client:    client,
+		namespace: namespace,
+		issuerRef: map[string]interface{}{"name": issuerName, "kind": issuerKind, "group": issuerGroup},
+		duration:  duration,
+		requester: requester,
+	}, nil
+}
+
+func (s *certManagerSigner) requests() dynamic.ResourceInterface {
+	return s.client.Resource(certificateRequests).Namespace(s.namespace)
+}
+
+// Submit creates the CertificateRequest. A previous one with the same name is
+// replaced if it is no longer needed.
+func (s *certManagerSigner) Submit(ctx context.Context, name string, pemCSR []byte, wantServerAuth bool) error {
+	var usages []interface{}
+	for _, usage := range requestedUsages(wantServerAuth) {
+		usages = append(usages, string(usage))
+	}
+	req := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": certificateRequests.GroupVersion().String(),
+		"kind":       "CertificateRequest",
+		"metadata": map[string]interface{}{
+			"name":        name,
+			"namespace":   s.namespace,
+			"annotations": map[string]interface{}{requesterAnnotation: s.requester},
+		},
+		"spec": map[string]interface{}{
+			"request":   base64.StdEncoding.EncodeToString(pemCSR),
+			"issuerRef": s.issuerRef,
+			"usages":    usages,
+			"duration":  s.duration.String(),
+		},
+	}}
+
+	fmt.Printf("Sending CertificateRequest %s to %s %s\n", name, s.issuerRef["kind"], s.issuerRef["name"])
+	_, err := s.requests().Create(ctx, req, types.CreateOptions{})
+	if k8s_errors.IsAlreadyExists(err) {
+		if err := s.deletePrevious(ctx, name); err != nil {
+			return err
+		}
+		_, err = s.requests().Create(ctx, req, types.CreateOptions{})
+	}
+	if err != nil {
+		return errors.Wrapf(err, "CertificateRequest.Create(%s) failed", name)
+	}
+	return nil
+}
+
+// deletePrevious deletes the existing CertificateRequest if it is ready,
+// denied or failed, or if this pod sent it. One still pending for another pod
+// is left alone, and an error returned.
+func (s *certManagerSigner) deletePrevious(ctx context.Context, name string) error {
+	obj, err := s.requests().Get(ctx, name, types.GetOptions{})
+	if err != nil {
+		if k8s_errors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "CertificateRequest.Get(%s) failed", name)
+	}
+	if requester := obj.GetAnnotations()[requesterAnnotation]; !requestDone(obj) && requester != s.requester {
+		return errors.Errorf("CertificateRequest %s is still pending for %q; approve, deny or delete it first",
+			name, requester)
+	}
+	err = s.requests().Delete(ctx, name, deleteOptions(obj.GetUID()))
+	if err != nil && !k8s_errors.IsNotFound(err) {
+		return errors.Wrapf(err, "CertificateRequest.Delete(%s) failed", name)
+	}
+	fmt.Printf("Deleted previous CertificateRequest: %s\n", name)
+	return nil
+}
+
+// Wait watches the CertificateRequest until it is Ready, denied or failed, for
+// at most --wait-timeout.
+func (s *certManagerSigner) Wait(ctx context.Context, name string) ([]byte, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, *waitTimeout)
+	defer cancel()
+	go printWaiting(waitCtx, func() {
+		fmt.Printf("%s: waiting for CertificateRequest %s to be ready\n", time.Now(), name)
+	})
+
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	lw := &cache.ListWatch{
+		ListFunc: func(options types.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = selector
+			return s.requests().List(waitCtx, options)
+		},
+		WatchFunc: func(options types.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = selector
+			return s.requests().Watch(waitCtx, options)
+		},
+	}
+
+	var pemCert []byte
+	var approved bool
+	_, err := watchtools.UntilWithSync(waitCtx, lw, &unstructured.Unstructured{}, nil,
+		func(event watch.Event) (bool, error) {
+			obj, ok := event.Object.(*unstructured.Unstructured)
+			if !ok || obj.GetName() != name {
+				return false, nil
+			}
+			if event.Type == watch.Deleted {
+				return false, errors.Errorf("CertificateRequest %s was deleted", name)
+			}
+			approved = hasCondition(obj, "Approved")
+			cert, done, err := s.checkRequest(obj)
+			pemCert = cert
+			return done, err
+		})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.Wrapf(ctx.Err(), "stopped waiting for CertificateRequest %s", name)
+		}
+		if waitCtx.Err() == context.DeadlineExceeded {
+			return nil, &TimeoutError{Name: name, Approved: approved}
+		}
+		return nil, err
+	}
+	return pemCert, nil
+}
+
+// hasCondition returns whether the condition of the given type is true.
+func hasCondition(obj *unstructured.Unstructured, condType string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		if cond, ok := c.(map[string]interface{}); ok && cond["type"] == condType && cond["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// requestDone returns whether the CertificateRequest is ready, denied or
+// failed.
+func requestDone(obj *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		condType, status := cond["type"], cond["status"]
+		if status == "True" && (condType == "Ready" || condType == "Denied" || condType == "InvalidRequest") {
+			return true
+		}
+		if condType == "Ready" && status == "False" && cond["reason"] == "Failed" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRequest returns the certificate of a Ready CertificateRequest, a
+// *DeniedError if it was denied, or a *FailedError if it failed. done is false while
+// the request is still pending.
+func (s *certManagerSigner) checkRequest(obj *unstructured.Unstructured) (pemCert []byte, done bool, err error) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		condType, _ := cond["type"].(string)
+		status, _ := cond["status"].(string)
+		reason, _ := cond["reason"].(string)
+		message, _ := cond["message"].(string)
+		switch {
+		case condType == "Denied" && status == "True":
+			return nil, true, &DeniedError{Name: obj.GetName(), Reason: reason, Message: message}
+		case condType == "InvalidRequest" && status == "True",
+			condType == "Ready" && status == "False" && reason == "Failed":
+			return nil, true, &FailedError{Name: obj.GetName(), Reason: reason, Message: message}
+		case condType == "Ready" && status == "True":
+			pemCert, err := nestedBytes(obj, "status", "certificate")
+			if err != nil || pemCert == nil {
+				return nil, true, errors.Errorf("CertificateRequest %s is ready but has no certificate", obj.GetName())
+			}
+			ca, err := nestedBytes(obj, "status", "ca")
+			if err != nil {
+				return nil, true, errors.Wrapf(err, "CertificateRequest %s has an invalid CA", obj.GetName())
+			}
+			s.ca = ca
+			fmt.Printf("CertificateRequest %s is ready: %s\n", obj.GetName(), message)
+			return pemCert, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// CA returns the CA bundle returned with the certificate, or by the
+// CertificateRequest which issued the stored certificate. It is nil if the
+// issuer doesn't return one.
+func (s *certManagerSigner) CA(ctx context.Context, name string) ([]byte, error) {
+	if s.ca != nil {
+		return s.ca, nil
+	}
+	obj, err := s.requests().Get(ctx, name, types.GetOptions{})
+	if err != nil {
+		if k8s_errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "CertificateRequest.Get(%s) failed", name)
+	}
+	return nestedBytes(obj, "status", "ca")
+}
+
+// Cancel deletes the CertificateRequest unless it was approved or denied.
+func (s *certManagerSigner) Cancel(ctx context.Context, name string) error {
+	obj, err := s.requests().Get(ctx, name, types.GetOptions{})
+	if err != nil {
+		if k8s_errors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "CertificateRequest.Get(%s) failed", name)
+	}
+	if hasCondition(obj, "Approved") || hasCondition(obj, "Denied") {
+		return nil
+	}
+	err = s.requests().Delete(ctx, name, deleteOptions(obj.GetUID()))
+	if err != nil && !k8s_errors.IsNotFound(err) {
+		return errors.Wrapf(err, "CertificateRequest.Delete(%s) failed", name)
+	}
+	fmt.Printf("Deleted pending CertificateRequest: %s\n", name)
+	return nil
+}
+
+// nestedBytes returns the base64-encoded []byte field at the given path, or
+// nil if it's not set.
+func nestedBytes(obj *unstructured.Unstructured, fields ...string) ([]byte, error) {
+	s, found, err := unstructured.NestedString(obj.Object, fields...)
+	if err != nil || !found || s == "" {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
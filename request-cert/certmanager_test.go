@@ -0,0 +1,338 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	types "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+const testRequestName = "crdb.node.cockroachdb-0"
+
+// newTestCertManagerSigner returns a certManagerSigner for pod-0 using a fake
+// dynamic client holding objs.
+func newTestCertManagerSigner(t *testing.T, objs ...runtime.Object) (*certManagerSigner, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{certificateRequests: "CertificateRequestList"}, objs...)
+	s, err := newCertManagerSigner(client, "crdb", "cockroachdb", "Issuer", "cert-manager.io", 90*24*time.Hour, "pod-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, client
+}
+
+// testCertificateRequest returns a CertificateRequest sent by requester, with
+// the given status.
+func testCertificateRequest(requester string, status map[string]interface{}) *unstructured.Unstructured {
+	metadata := map[string]interface{}{
+		"name":      testRequestName,
+		"namespace": "crdb",
+		"uid":       "previous",
+	}
+	if requester != "" {
+		metadata["annotations"] = map[string]interface{}{requesterAnnotation: requester}
+	}
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": certificateRequests.GroupVersion().String(),
+		"kind":       "CertificateRequest",
+		"metadata":   metadata,
+		"spec":       map[string]interface{}{"request": "cHJldmlvdXM="},
+	}}
+	if status != nil {
+		obj.Object["status"] = status
+	}
+	return obj
+}
+
+// requestStatus returns a status with a single condition, and the given
+// certificate and CA.
+func requestStatus(condType, status, reason string, cert, ca []byte) map[string]interface{} {
+	s := map[string]interface{}{
+		"conditions": []interface{}{map[string]interface{}{
+			"type": condType, "status": status, "reason": reason, "message": "by the test",
+		}},
+	}
+	if cert != nil {
+		s["certificate"] = base64.StdEncoding.EncodeToString(cert)
+	}
+	if ca != nil {
+		s["ca"] = base64.StdEncoding.EncodeToString(ca)
+	}
+	return s
+}
+
+func TestCertManagerSignerSubmit(t *testing.T) {
+	testCases := []struct {
+		name     string
+		previous *unstructured.Unstructured
+		// replaced is whether the previous request is replaced by the new one.
+		replaced bool
+	}{
+		{name: "no previous request", replaced: true},
+		{name: "pending for this pod", previous: testCertificateRequest("pod-0", nil), replaced: true},
+		{name: "pending for another pod", previous: testCertificateRequest("pod-1", nil)},
+		{name: "pending without requester", previous: testCertificateRequest("", nil)},
+		{
+			name:     "ready",
+			previous: testCertificateRequest("pod-1", requestStatus("Ready", "True", "Issued", []byte("cert"), nil)),
+			replaced: true,
+		},
+		{
+			name:     "denied",
+			previous: testCertificateRequest("pod-1", requestStatus("Denied", "True", "Policy", nil, nil)),
+			replaced: true,
+		},
+		{
+			name:     "failed",
+			previous: testCertificateRequest("pod-1", requestStatus("Ready", "False", "Failed", nil, nil)),
+			replaced: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var objs []runtime.Object
+			if tc.previous != nil {
+				objs = append(objs, tc.previous)
+			}
+			s, client := newTestCertManagerSigner(t, objs...)
+			pemCSR := []byte("-----BEGIN CERTIFICATE REQUEST-----\n")
+
+			err := s.Submit(context.Background(), testRequestName, pemCSR, true)
+			if tc.replaced && err != nil {
+				t.Fatal(err)
+			} else if !tc.replaced && err == nil {
+				t.Fatal("expected an error replacing another pod's pending request")
+			}
+
+			obj, err := client.Resource(certificateRequests).Namespace("crdb").Get(
+				context.Background(), testRequestName, types.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.replaced {
+				if obj.GetUID() != tc.previous.GetUID() {
+					t.Errorf("previous request was deleted")
+				}
+				return
+			}
+			if got := obj.GetAnnotations()[requesterAnnotation]; got != "pod-0" {
+				t.Errorf("requester annotation is %q, want pod-0", got)
+			}
+			if got, _ := nestedBytes(obj, "spec", "request"); !bytes.Equal(got, pemCSR) {
+				t.Errorf("request is %q, want %q", got, pemCSR)
+			}
+			if got, _, _ := unstructured.NestedString(obj.Object, "spec", "issuerRef", "name"); got != "cockroachdb" {
+				t.Errorf("issuer is %q, want cockroachdb", got)
+			}
+			if got, _, _ := unstructured.NestedString(obj.Object, "spec", "duration"); got != "2160h0m0s" {
+				t.Errorf("duration is %q, want 2160h0m0s", got)
+			}
+			usages, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "usages")
+			if !containsString(usages, "server auth") || !containsString(usages, "client auth") {
+				t.Errorf("usages are %v, want server auth and client auth", usages)
+			}
+		})
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCertManagerSignerWait(t *testing.T) {
+	defer func(timeout time.Duration) { *waitTimeout = timeout }(*waitTimeout)
+	*waitTimeout = 100 * time.Millisecond
+
+	testCases := []struct {
+		name    string
+		status  map[string]interface{}
+		check   func(error) bool
+		wantErr string
+	}{
+		{
+			name:    "denied",
+			status:  requestStatus("Denied", "True", "Policy", nil, nil),
+			check:   func(err error) bool { _, ok := err.(*DeniedError); return ok },
+			wantErr: "*DeniedError",
+		},
+		{
+			name:    "invalid request",
+			status:  requestStatus("InvalidRequest", "True", "BadConfig", nil, nil),
+			check:   func(err error) bool { _, ok := err.(*FailedError); return ok },
+			wantErr: "*FailedError",
+		},
+		{
+			name:    "failed",
+			status:  requestStatus("Ready", "False", "Failed", nil, nil),
+			check:   func(err error) bool { _, ok := err.(*FailedError); return ok },
+			wantErr: "*FailedError",
+		},
+		{
+			name:   "ready without certificate",
+			status: requestStatus("Ready", "True", "Issued", nil, nil),
+			check: func(err error) bool {
+				_, denied := err.(*DeniedError)
+				_, failed := err.(*FailedError)
+				return err != nil && !denied && !failed
+			},
+			wantErr: "an error",
+		},
+		{
+			name: "approved but not ready",
+			status: map[string]interface{}{"conditions": []interface{}{
+				map[string]interface{}{"type": "Approved", "status": "True"},
+				map[string]interface{}{"type": "Ready", "status": "False", "reason": "Pending"},
+			}},
+			check: func(err error) bool {
+				timeout, ok := err.(*TimeoutError)
+				return ok && timeout.Approved
+			},
+			wantErr: "an approved *TimeoutError",
+		},
+		{
+			name: "pending",
+			check: func(err error) bool {
+				timeout, ok := err.(*TimeoutError)
+				return ok && !timeout.Approved
+			},
+			wantErr: "a pending *TimeoutError",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := newTestCertManagerSigner(t, testCertificateRequest("pod-0", tc.status))
+			_, err := s.Wait(context.Background(), testRequestName)
+			if !tc.check(err) {
+				t.Errorf("got error %v, want %s", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCertManagerSignerReady(t *testing.T) {
+	ctx := context.Background()
+	status := requestStatus("Ready", "True", "Issued", []byte("certificate"), []byte("CA bundle"))
+	s, client := newTestCertManagerSigner(t, testCertificateRequest("pod-0", status))
+
+	cert, err := s.Wait(ctx, testRequestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(cert) != "certificate" {
+		t.Errorf("got certificate %q, want %q", cert, "certificate")
+	}
+
+	// The CA bundle is the one returned with the certificate, even once the
+	// request is gone.
+	if err := client.Resource(certificateRequests).Namespace("crdb").Delete(
+		ctx, testRequestName, types.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := s.CA(ctx, testRequestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ca) != "CA bundle" {
+		t.Errorf("got CA %q, want %q", ca, "CA bundle")
+	}
+}
+
+func TestCertManagerSignerCA(t *testing.T) {
+	ctx := context.Background()
+
+	// Without a new certificate, the CA is read from the request which issued
+	// the stored one.
+	status := requestStatus("Ready", "True", "Issued", []byte("certificate"), []byte("CA bundle"))
+	s, _ := newTestCertManagerSigner(t, testCertificateRequest("pod-0", status))
+	ca, err := s.CA(ctx, testRequestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ca) != "CA bundle" {
+		t.Errorf("got CA %q, want %q", ca, "CA bundle")
+	}
+
+	// Issuers which return no CA, and missing requests, give none.
+	for _, objs := range [][]runtime.Object{
+		{testCertificateRequest("pod-0", requestStatus("Ready", "True", "Issued", []byte("certificate"), nil))},
+		nil,
+	} {
+		s, _ := newTestCertManagerSigner(t, objs...)
+		ca, err := s.CA(ctx, testRequestName)
+		if err != nil || ca != nil {
+			t.Errorf("got CA %q, %v, want none", ca, err)
+		}
+	}
+}
+
+func TestSignerCA(t *testing.T) {
+	ctx := context.Background()
+	status := requestStatus("Ready", "True", "Issued", []byte("certificate"), []byte("CA bundle"))
+	s, _ := newTestCertManagerSigner(t, testCertificateRequest("pod-0", status))
+	ca, err := signerCA(ctx, s, testRequestName, []byte("stored CA"))
+	if err != nil || string(ca) != "CA bundle" {
+		t.Errorf("got CA %q, %v, want the CA from the request", ca, err)
+	}
+
+	// Once the request is deleted, the CA stored in the secret is used.
+	s, _ = newTestCertManagerSigner(t)
+	ca, err = signerCA(ctx, s, testRequestName, []byte("stored CA"))
+	if err != nil || string(ca) != "stored CA" {
+		t.Errorf("got CA %q, %v, want the stored CA", ca, err)
+	}
+}
+
+func TestCertManagerSignerCancel(t *testing.T) {
+	testCases := []struct {
+		name    string
+		status  map[string]interface{}
+		deleted bool
+	}{
+		{name: "pending", deleted: true},
+		{name: "approved", status: requestStatus("Approved", "True", "Policy", nil, nil)},
+		{name: "denied", status: requestStatus("Denied", "True", "Policy", nil, nil)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, client := newTestCertManagerSigner(t, testCertificateRequest("pod-0", tc.status))
+			if err := s.Cancel(context.Background(), testRequestName); err != nil {
+				t.Fatal(err)
+			}
+			list, err := client.Resource(certificateRequests).Namespace("crdb").List(
+				context.Background(), types.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deleted := len(list.Items) == 0; deleted != tc.deleted {
+				t.Errorf("deleted = %t, want %t", deleted, tc.deleted)
+			}
+		})
+	}
+}
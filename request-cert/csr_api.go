@@ -0,0 +1,264 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/pkg/errors"
+	certificates "k8s.io/api/certificates/v1"
+	certificatesv1beta1 "k8s.io/api/certificates/v1beta1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	types "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s_types "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+var signerNameFlag = flag.String("signer-name", "", "signerName of the CSR. Defaults to "+
+	certificates.KubeAPIServerClientSignerName+" for client certificates; required for node certificates "+
+	"unless the cluster only serves certificates.k8s.io/v1beta1")
+
+// signerUsages are the usages accepted by the built-in Kubernetes signers.
+// The certificates.k8s.io/v1 API rejects CSRs requesting other usages from
+// them. Custom signers decide for themselves.
+var signerUsages = map[string][]certificates.KeyUsage{
+	certificates.KubeAPIServerClientSignerName: {
+		certificates.UsageClientAuth, certificates.UsageDigitalSignature, certificates.UsageKeyEncipherment,
+	},
+	certificates.KubeAPIServerClientKubeletSignerName: {
+		certificates.UsageClientAuth, certificates.UsageDigitalSignature, certificates.UsageKeyEncipherment,
+	},
+	certificates.KubeletServingSignerName: {
+		certificates.UsageServerAuth, certificates.UsageDigitalSignature, certificates.UsageKeyEncipherment,
+	},
+}
+
+// signerName returns the signer to request the certificate from.
+func signerName(wantServerAuth bool) string {
+	if *signerNameFlag != "" {
+		return *signerNameFlag
+	}
+	if !wantServerAuth {
+		return certificates.KubeAPIServerClientSignerName
+	}
+	return ""
+}
+
+// csrClient creates and watches CSRs through the certificates.k8s.io/v1 API,
+// or through v1beta1 on clusters which don't serve v1 yet. Objects are always
+// returned as v1.
+type csrClient interface {
+	// checkSigner returns an error if a CSR for signer with the given usages
+	// would be rejected.
+	checkSigner(signer string, usages []certificates.KeyUsage) error
+	create(ctx context.Context, csr *certificates.CertificateSigningRequest) (*certificates.CertificateSigningRequest, error)
+	get(ctx context.Context, name string) (*certificates.CertificateSigningRequest, error)
+	list(ctx context.Context, opts types.ListOptions) (*certificates.CertificateSigningRequestList, error)
+	watch(ctx context.Context, opts types.ListOptions) (watch.Interface, error)
+	// delete deletes the CSR, only if it has the given UID unless uid is empty.
+	delete(ctx context.Context, name string, uid k8s_types.UID) error
+}
+
+// newCSRClient returns a csrClient for the newest CSR API version served by
+// the cluster.
+func newCSRClient(client kubernetes.Interface) (csrClient, error) {
+	_, err := client.Discovery().ServerResourcesForGroupVersion(certificates.SchemeGroupVersion.String())
+	if err == nil {
+		return &csrClientV1{client: client}, nil
+	}
+	if !k8s_errors.IsNotFound(err) {
+		return nil, errors.Wrap(err, "discovering the certificates.k8s.io API version failed")
+	}
+	fmt.Printf("%s is not served, falling back to %s\n",
+		certificates.SchemeGroupVersion, certificatesv1beta1.SchemeGroupVersion)
+	return &csrClientV1beta1{client: client}, nil
+}
+
+// checkSignerUsages returns an error if signer is a built-in signer which
+// doesn't accept all of usages.
+func checkSignerUsages(signer string, usages []certificates.KeyUsage) error {
+	allowed, ok := signerUsages[signer]
+	if !ok {
+		return nil
+	}
+	for _, usage := range usages {
+		found := false
+		for _, a := range allowed {
+			if usage == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("signer %s does not accept usage %q; use --signer-name to select a signer which does", signer, usage)
+		}
+	}
+	return nil
+}
+
+type csrClientV1 struct {
+	client kubernetes.Interface
+}
+
+func (c *csrClientV1) checkSigner(signer string, usages []certificates.KeyUsage) error {
+	switch signer {
+	case "":
+		return errors.Errorf("--signer-name is required to request a certificate with usages %v through %s",
+			usages, certificates.SchemeGroupVersion)
+	case certificatesv1beta1.LegacyUnknownSignerName:
+		return errors.Errorf("signer %s cannot be used with %s", signer, certificates.SchemeGroupVersion)
+	}
+	return checkSignerUsages(signer, usages)
+}
+
+func (c *csrClientV1) create(
+	ctx context.Context, csr *certificates.CertificateSigningRequest,
+) (*certificates.CertificateSigningRequest, error) {
+	return c.client.CertificatesV1().CertificateSigningRequests().Create(ctx, csr, types.CreateOptions{})
+}
+
+func (c *csrClientV1) get(ctx context.Context, name string) (*certificates.CertificateSigningRequest, error) {
+	return c.client.CertificatesV1().CertificateSigningRequests().Get(ctx, name, types.GetOptions{})
+}
+
+func (c *csrClientV1) list(
+	ctx context.Context, opts types.ListOptions,
+) (*certificates.CertificateSigningRequestList, error) {
+	return c.client.CertificatesV1().CertificateSigningRequests().List(ctx, opts)
+}
+
+func (c *csrClientV1) watch(ctx context.Context, opts types.ListOptions) (watch.Interface, error) {
+	return c.client.CertificatesV1().CertificateSigningRequests().Watch(ctx, opts)
+}
+
+func (c *csrClientV1) delete(ctx context.Context, name string, uid k8s_types.UID) error {
+	return c.client.CertificatesV1().CertificateSigningRequests().Delete(ctx, name, deleteOptions(uid))
+}
+
+type csrClientV1beta1 struct {
+	client kubernetes.Interface
+}
+
+func (c *csrClientV1beta1) checkSigner(signer string, usages []certificates.KeyUsage) error {
+	// An empty signer defaults to kubernetes.io/legacy-unknown in v1beta1.
+	return checkSignerUsages(signer, usages)
+}
+
+func (c *csrClientV1beta1) create(
+	ctx context.Context, csr *certificates.CertificateSigningRequest,
+) (*certificates.CertificateSigningRequest, error) {
+	req := &certificatesv1beta1.CertificateSigningRequest{
+		ObjectMeta: csr.ObjectMeta,
+		Spec: certificatesv1beta1.CertificateSigningRequestSpec{
+			Request: csr.Spec.Request,
+		},
+	}
+	if csr.Spec.SignerName != "" {
+		req.Spec.SignerName = &csr.Spec.SignerName
+	}
+	for _, usage := range csr.Spec.Usages {
+		req.Spec.Usages = append(req.Spec.Usages, certificatesv1beta1.KeyUsage(usage))
+	}
+	resp, err := c.client.CertificatesV1beta1().CertificateSigningRequests().Create(ctx, req, types.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromV1beta1(resp), nil
+}
+
+func (c *csrClientV1beta1) get(ctx context.Context, name string) (*certificates.CertificateSigningRequest, error) {
+	resp, err := c.client.CertificatesV1beta1().CertificateSigningRequests().Get(ctx, name, types.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return fromV1beta1(resp), nil
+}
+
+func (c *csrClientV1beta1) list(
+	ctx context.Context, opts types.ListOptions,
+) (*certificates.CertificateSigningRequestList, error) {
+	resp, err := c.client.CertificatesV1beta1().CertificateSigningRequests().List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := &certificates.CertificateSigningRequestList{ListMeta: resp.ListMeta}
+	for i := range resp.Items {
+		out.Items = append(out.Items, *fromV1beta1(&resp.Items[i]))
+	}
+	return out, nil
+}
+
+func (c *csrClientV1beta1) watch(ctx context.Context, opts types.ListOptions) (watch.Interface, error) {
+	w, err := c.client.CertificatesV1beta1().CertificateSigningRequests().Watch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		if csr, ok := event.Object.(*certificatesv1beta1.CertificateSigningRequest); ok {
+			event.Object = fromV1beta1(csr)
+		}
+		return event, true
+	}), nil
+}
+
+func (c *csrClientV1beta1) delete(ctx context.Context, name string, uid k8s_types.UID) error {
+	return c.client.CertificatesV1beta1().CertificateSigningRequests().Delete(ctx, name, deleteOptions(uid))
+}
+
+// deleteOptions returns options to delete an object only if it has the given
+// UID, or unconditionally if uid is empty. The UID precondition keeps an object
+// of the same name created since uid was read, e.g. by another pod's request.
+func deleteOptions(uid k8s_types.UID) types.DeleteOptions {
+	if uid == "" {
+		return types.DeleteOptions{}
+	}
+	return types.DeleteOptions{Preconditions: types.NewUIDPreconditions(string(uid))}
+}
+
+// fromV1beta1 converts the fields of a v1beta1 CSR used by request-cert to v1.
+func fromV1beta1(in *certificatesv1beta1.CertificateSigningRequest) *certificates.CertificateSigningRequest {
+	out := &certificates.CertificateSigningRequest{
+		ObjectMeta: in.ObjectMeta,
+		Spec: certificates.CertificateSigningRequestSpec{
+			Request:  in.Spec.Request,
+			Username: in.Spec.Username,
+			UID:      in.Spec.UID,
+			Groups:   in.Spec.Groups,
+		},
+		Status: certificates.CertificateSigningRequestStatus{
+			Certificate: in.Status.Certificate,
+		},
+	}
+	if in.Spec.SignerName != nil {
+		out.Spec.SignerName = *in.Spec.SignerName
+	}
+	for _, usage := range in.Spec.Usages {
+		out.Spec.Usages = append(out.Spec.Usages, certificates.KeyUsage(usage))
+	}
+	for _, cond := range in.Status.Conditions {
+		out.Status.Conditions = append(out.Status.Conditions, certificates.CertificateSigningRequestCondition{
+			Type:               certificates.RequestConditionType(cond.Type),
+			Status:             cond.Status,
+			Reason:             cond.Reason,
+			Message:            cond.Message,
+			LastUpdateTime:     cond.LastUpdateTime,
+			LastTransitionTime: cond.LastTransitionTime,
+		})
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Exit codes when no certificate could be obtained.
+const (
+	exitError   = 1
+	exitDenied  = 2
+	exitFailed  = 3
+	exitTimeout = 4
+)
+
+// maxTerminationMessage is the size Kubernetes truncates termination
+// messages to.
+const maxTerminationMessage = 4096
+
+var terminationLog = flag.String("termination-log", "/dev/termination-log", "file the reason no certificate "+
+	"was issued is written to, shown by 'kubectl describe pod'; empty to disable")
+
+// exitCode returns the exit code for a signing error.
+func exitCode(err error) int {
+	switch errors.Cause(err).(type) {
+	case *DeniedError:
+		return exitDenied
+	case *FailedError:
+		return exitFailed
+	case *TimeoutError:
+		return exitTimeout
+	default:
+		return exitError
+	}
+}
+
+// fatalCertificateError logs why no certificate could be obtained, writes it
+// to the termination log and exits with the code for the error.
+func fatalCertificateError(msg string, err error) {
+	message := fmt.Sprintf("%s: %v", msg, err)
+	log.Print(message)
+	if len(*terminationLog) != 0 {
+		if len(message) > maxTerminationMessage {
+			message = message[:maxTerminationMessage]
+		}
+		if err := ioutil.WriteFile(*terminationLog, []byte(message), 0644); err != nil {
+			log.Printf("could not write termination message: %v", err)
+		}
+	}
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,104 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// testExitErrors are the errors fatalCertificateError is tested with, by name.
+var testExitErrors = map[string]error{
+	"denied":  &DeniedError{Name: "crdb.node.cockroachdb-0", Reason: "PolicyDenied", Message: "not allowed"},
+	"failed":  &FailedError{Name: "crdb.node.cockroachdb-0", Reason: "SignerFailed", Message: "CA expired"},
+	"timeout": &TimeoutError{Name: "crdb.node.cockroachdb-0"},
+	"generic": errors.New("connection refused"),
+	"long":    errors.New(strings.Repeat("x", 2*maxTerminationMessage)),
+}
+
+func TestExitCode(t *testing.T) {
+	// The exit codes are documented, and relied on by scripts.
+	testCases := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "denied", err: testExitErrors["denied"], want: 2},
+		{name: "failed", err: testExitErrors["failed"], want: 3},
+		{name: "timeout", err: testExitErrors["timeout"], want: 4},
+		{name: "generic", err: testExitErrors["generic"], want: 1},
+		{name: "wrapped denied", err: errors.Wrap(testExitErrors["denied"], "failed to get certificate"), want: 2},
+		{name: "wrapped timeout", err: errors.Wrap(testExitErrors["timeout"], "failed to get certificate"), want: 4},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exitCode(tc.err); got != tc.want {
+				t.Errorf("got exit code %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFatalCertificateError(t *testing.T) {
+	// fatalCertificateError exits, so it is run in a child process.
+	if name := os.Getenv("TEST_FATAL_CERTIFICATE_ERROR"); name != "" {
+		fatalCertificateError("failed to get certificate", testExitErrors[name])
+		return
+	}
+
+	testCases := []struct {
+		name     string
+		wantCode int
+	}{
+		{name: "denied", wantCode: 2},
+		{name: "failed", wantCode: 3},
+		{name: "timeout", wantCode: 4},
+		{name: "generic", wantCode: 1},
+		{name: "long", wantCode: 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			terminationLog := filepath.Join(t.TempDir(), "termination-log")
+			cmd := exec.Command(os.Args[0], "-test.run=^TestFatalCertificateError$", "-termination-log="+terminationLog)
+			cmd.Env = append(os.Environ(), "TEST_FATAL_CERTIFICATE_ERROR="+tc.name)
+			err := cmd.Run()
+			exitErr, ok := err.(*exec.ExitError)
+			if !ok {
+				t.Fatalf("got %v, want exit code %d", err, tc.wantCode)
+			}
+			if code := exitErr.ExitCode(); code != tc.wantCode {
+				t.Errorf("got exit code %d, want %d", code, tc.wantCode)
+			}
+
+			message, err := ioutil.ReadFile(terminationLog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "failed to get certificate: " + testExitErrors[tc.name].Error()
+			if len(want) > maxTerminationMessage {
+				want = want[:maxTerminationMessage]
+			}
+			if string(message) != want {
+				t.Errorf("got termination message %q, want %q", message, want)
+			}
+		})
+	}
+}
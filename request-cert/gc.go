@@ -0,0 +1,239 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	certificates "k8s.io/api/certificates/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	types "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// gcFlags are the flags of the gc subcommand: request-cert gc [flags].
+var (
+	gcFlags      = flag.NewFlagSet("gc", flag.ExitOnError)
+	gcPendingTTL = gcFlags.Duration("pending-ttl", 24*time.Hour,
+		"delete CSRs which have not been issued and stored in a secret for longer than this")
+	gcDryRun = gcFlags.Bool("dry-run", false, "only report the CSRs which would be deleted")
+)
+
+func init() {
+	gcFlags.StringVar(namespace, "namespace", "", "kubernetes namespace whose CSRs are collected")
+	gcFlags.StringVar(kubeConfig, "kubeconfig", "", "config file if running from outside the cluster")
+}
+
+// runGC runs the gc subcommand with the arguments following "gc". It exits
+// with a non-zero code if any CSR could not be deleted.
+func runGC(args []string) {
+	if err := gcFlags.Parse(args); err != nil {
+		log.Fatal(err)
+	}
+	if len(*namespace) == 0 {
+		log.Fatal("--namespace is required and must not be empty")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	client, err := getClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	csrAPI, err := newCSRClient(client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gc := &csrCollector{
+		client:     client,
+		csrAPI:     csrAPI,
+		namespace:  *namespace,
+		pendingTTL: *gcPendingTTL,
+		dryRun:     *gcDryRun,
+	}
+	results, err := gc.collect(ctx, time.Now())
+	if err != nil {
+		log.Fatalf("failed to collect CSRs: %v", err)
+	}
+	if failed := printGCReport(os.Stdout, results, *gcDryRun); failed > 0 {
+		log.Fatalf("failed to collect %d CSRs", failed)
+	}
+}
+
+// csrCollector deletes the CSRs request-cert created for a namespace, named
+// <namespace>.node.* and <namespace>.client.*, once they are no longer
+// needed: issued and stored in the secret of the same name, denied, failed,
+// or pending for longer than pendingTTL.
+type csrCollector struct {
+	client     kubernetes.Interface
+	csrAPI     csrClient
+	namespace  string
+	pendingTTL time.Duration
+	dryRun     bool
+}
+
+// gcResult is what happened to a CSR.
+type gcResult struct {
+	name string
+	// reason tells why the CSR was, or would be, deleted or kept.
+	reason string
+	// deleted is set if the CSR was deleted, or would be with --dry-run.
+	deleted bool
+	err     error
+}
+
+// collect lists the namespace's CSRs and deletes the ones no longer needed,
+// unless dryRun is set. Results are sorted by CSR name. An error is returned
+// if the CSRs can't be listed; failures to delete a CSR are reported in its
+// result.
+func (g *csrCollector) collect(ctx context.Context, now time.Time) ([]gcResult, error) {
+	var results []gcResult
+	opts := types.ListOptions{Limit: 500}
+	for {
+		list, err := g.csrAPI.list(ctx, opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "CertificateSigningRequest.List failed")
+		}
+		for i := range list.Items {
+			csr := &list.Items[i]
+			if !g.owns(csr.Name) {
+				continue
+			}
+			results = append(results, g.collectCSR(ctx, csr, now))
+		}
+		if list.Continue == "" {
+			break
+		}
+		opts.Continue = list.Continue
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].name < results[j].name })
+	return results, nil
+}
+
+// owns returns whether name follows request-cert's naming scheme for the
+// namespace.
+func (g *csrCollector) owns(name string) bool {
+	return strings.HasPrefix(name, g.namespace+".node.") || strings.HasPrefix(name, g.namespace+".client.")
+}
+
+// collectCSR deletes csr if it is no longer needed.
+func (g *csrCollector) collectCSR(
+	ctx context.Context, csr *certificates.CertificateSigningRequest, now time.Time,
+) gcResult {
+	result := gcResult{name: csr.Name}
+	reason, remove, err := g.check(ctx, csr, now)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.reason = reason
+	if !remove || g.dryRun {
+		result.deleted = remove
+		return result
+	}
+
+	switch err := g.csrAPI.delete(ctx, csr.Name, csr.UID); {
+	case err == nil, k8s_errors.IsNotFound(err):
+		result.deleted = true
+	case k8s_errors.IsConflict(err):
+		result.reason = "replaced since it was listed"
+	default:
+		result.err = errors.Wrapf(err, "CertificateSigningRequest.Delete(%s) failed", csr.Name)
+	}
+	return result
+}
+
+// check returns why csr should be deleted or kept.
+func (g *csrCollector) check(
+	ctx context.Context, csr *certificates.CertificateSigningRequest, now time.Time,
+) (reason string, remove bool, err error) {
+	conds := getCSRConditions(csr)
+	switch {
+	case conds.denied != nil:
+		return "denied: " + conds.denied.Reason, true, nil
+	case conds.failed != nil:
+		return "failed: " + conds.failed.Reason, true, nil
+	}
+
+	if len(csr.Status.Certificate) != 0 {
+		secret, err := g.client.CoreV1().Secrets(g.namespace).Get(ctx, csr.Name, types.GetOptions{})
+		if err != nil && !k8s_errors.IsNotFound(err) {
+			return "", false, errors.Wrapf(err, "could not read secret %s", csr.Name)
+		}
+		if err == nil && bytes.Equal(secret.Data["cert"], csr.Status.Certificate) {
+			return "issued and stored in secret " + csr.Name, true, nil
+		}
+	}
+
+	// Approved CSRs are pending until the certificate is issued and stored.
+	age := now.Sub(csr.CreationTimestamp.Time).Round(time.Second)
+	state := "pending"
+	if len(csr.Status.Certificate) != 0 {
+		state = "issued but not stored"
+	} else if conds.approved != nil {
+		state = "approved but not issued"
+	}
+	if age > g.pendingTTL {
+		return fmt.Sprintf("%s for %s, longer than --pending-ttl", state, age), true, nil
+	}
+	return fmt.Sprintf("%s for %s", state, age), false, nil
+}
+
+// printGCReport writes a line per CSR to w, and returns the number of CSRs
+// which could not be checked or deleted.
+func printGCReport(w io.Writer, results []gcResult, dryRun bool) int {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tACTION\tREASON")
+	var deleted, failed int
+	for _, r := range results {
+		action := "keep"
+		reason := r.reason
+		switch {
+		case r.err != nil:
+			action = "error"
+			reason = r.err.Error()
+			failed++
+		case r.deleted && dryRun:
+			action = "would delete"
+			deleted++
+		case r.deleted:
+			action = "deleted"
+			deleted++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.name, action, reason)
+	}
+	tw.Flush()
+
+	verb := "Deleted"
+	if dryRun {
+		verb = "Would delete"
+	}
+	fmt.Fprintf(w, "%s %d of %d CSRs\n", verb, deleted, len(results))
+	return failed
+}
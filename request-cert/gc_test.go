@@ -0,0 +1,158 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	certificates "k8s.io/api/certificates/v1"
+	core "k8s.io/api/core/v1"
+	types "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCSRCollector(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	csr := func(name string, age time.Duration, cert string, conds ...certificates.CertificateSigningRequestCondition) runtime.Object {
+		return &certificates.CertificateSigningRequest{
+			ObjectMeta: types.ObjectMeta{Name: name, CreationTimestamp: types.NewTime(now.Add(-age))},
+			Status: certificates.CertificateSigningRequestStatus{
+				Conditions:  conds,
+				Certificate: []byte(cert),
+			},
+		}
+	}
+	secret := func(name string, cert string) runtime.Object {
+		return &core.Secret{
+			ObjectMeta: types.ObjectMeta{Name: name, Namespace: "crdb"},
+			Data:       map[string][]byte{"cert": []byte(cert), "key": []byte("key")},
+		}
+	}
+	approved := condition(certificates.CertificateApproved)
+
+	objs := []runtime.Object{
+		csr("crdb.node.stored", time.Minute, "cert", approved),
+		secret("crdb.node.stored", "cert"),
+		csr("crdb.node.replaced", time.Minute, "old cert", approved),
+		secret("crdb.node.replaced", "new cert"),
+		csr("crdb.node.unstored", time.Minute, "cert", approved),
+		csr("crdb.node.unstored-expired", 25*time.Hour, "cert", approved),
+		csr("crdb.client.denied", time.Minute, "", condition(certificates.CertificateDenied)),
+		csr("crdb.client.failed", time.Minute, "", approved, condition(certificates.CertificateFailed)),
+		csr("crdb.node.pending", time.Hour, ""),
+		csr("crdb.node.pending-expired", 25*time.Hour, ""),
+		csr("crdb.node.approved-expired", 25*time.Hour, "", approved),
+		// Other namespaces' and other requesters' CSRs are left alone.
+		csr("other.node.pending-expired", 25*time.Hour, ""),
+		csr("node-csr-kubelet", 25*time.Hour, "", condition(certificates.CertificateDenied)),
+	}
+	want := []struct {
+		name    string
+		deleted bool
+		reason  string
+	}{
+		{name: "crdb.client.denied", deleted: true, reason: "denied: Test"},
+		{name: "crdb.client.failed", deleted: true, reason: "failed: Test"},
+		{name: "crdb.node.approved-expired", deleted: true, reason: "approved but not issued for 25h0m0s, longer than --pending-ttl"},
+		{name: "crdb.node.pending", reason: "pending for 1h0m0s"},
+		{name: "crdb.node.pending-expired", deleted: true, reason: "pending for 25h0m0s, longer than --pending-ttl"},
+		{name: "crdb.node.replaced", reason: "issued but not stored for 1m0s"},
+		{name: "crdb.node.stored", deleted: true, reason: "issued and stored in secret crdb.node.stored"},
+		{name: "crdb.node.unstored", reason: "issued but not stored for 1m0s"},
+		{name: "crdb.node.unstored-expired", deleted: true, reason: "issued but not stored for 25h0m0s, longer than --pending-ttl"},
+	}
+
+	for _, dryRun := range []bool{false, true} {
+		client := fake.NewSimpleClientset(objs...)
+		gc := &csrCollector{
+			client:     client,
+			csrAPI:     &csrClientV1{client: client},
+			namespace:  "crdb",
+			pendingTTL: 24 * time.Hour,
+			dryRun:     dryRun,
+		}
+		results, err := gc.collect(context.Background(), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != len(want) {
+			t.Fatalf("dry-run=%t: got %d results, want %d: %+v", dryRun, len(results), len(want), results)
+		}
+		for i, r := range results {
+			w := want[i]
+			if r.name != w.name || r.deleted != w.deleted || r.reason != w.reason || r.err != nil {
+				t.Errorf("dry-run=%t: got %+v, want %+v", dryRun, r, w)
+			}
+		}
+
+		// Only CSRs reported as deleted are gone, and none with --dry-run.
+		list, err := client.CertificatesV1().CertificateSigningRequests().List(context.Background(), types.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		remaining := make(map[string]bool)
+		for _, item := range list.Items {
+			remaining[item.Name] = true
+		}
+		for _, w := range want {
+			if gone := !remaining[w.name]; gone != (w.deleted && !dryRun) {
+				t.Errorf("dry-run=%t: %s deleted = %t, want %t", dryRun, w.name, gone, w.deleted && !dryRun)
+			}
+		}
+		for _, name := range []string{"other.node.pending-expired", "node-csr-kubelet"} {
+			if !remaining[name] {
+				t.Errorf("dry-run=%t: %s was deleted", dryRun, name)
+			}
+		}
+	}
+}
+
+func TestPrintGCReport(t *testing.T) {
+	results := []gcResult{
+		{name: "crdb.client.denied", reason: "denied: Test", deleted: true},
+		{name: "crdb.node.pending", reason: "pending for 1h0m0s"},
+		{name: "crdb.node.stored", err: errors.New("test error")},
+	}
+	for _, tc := range []struct {
+		dryRun  bool
+		action  string
+		summary string
+	}{
+		{dryRun: false, action: "deleted", summary: "Deleted 1 of 3 CSRs"},
+		{dryRun: true, action: "would delete", summary: "Would delete 1 of 3 CSRs"},
+	} {
+		var buf bytes.Buffer
+		if failed := printGCReport(&buf, results, tc.dryRun); failed != 1 {
+			t.Errorf("dry-run=%t: got %d failures, want 1", tc.dryRun, failed)
+		}
+		out := buf.String()
+		for _, want := range []string{
+			"crdb.client.denied  " + tc.action,
+			"crdb.node.pending   keep",
+			"crdb.node.stored    error",
+			tc.summary,
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("dry-run=%t: report doesn't contain %q:\n%s", tc.dryRun, want, out)
+			}
+		}
+	}
+}
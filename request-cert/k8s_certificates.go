@@ -17,45 +17,76 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
-	certificates "k8s.io/api/certificates/v1beta1"
+	certificates "k8s.io/api/certificates/v1"
 	core "k8s.io/api/core/v1"
 	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
 	types "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8s_types "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
-)
-
-const (
-	watchTimeout = time.Hour
+	watchtools "k8s.io/client-go/tools/watch"
 )
 
 var (
-	kubeConfig   = flag.String("kubeconfig", "", "config file if running from outside the cluster")
-	client       *kubernetes.Clientset
-	clientError  error
-	ChannelError = errors.New("error on the channel")
+	kubeConfig         = flag.String("kubeconfig", "", "config file if running from outside the cluster")
+	client             kubernetes.Interface
+	clientError        error
+	dynamicClient      dynamic.Interface
+	dynamicClientError error
 )
 
-func getClient() (*kubernetes.Clientset, error) {
+// getClient returns the Kubernetes client, creating it on first use. It
+// returns ctx's error once ctx is done, so nothing is requested after SIGTERM.
+func getClient(ctx context.Context) (kubernetes.Interface, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if client == nil && clientError == nil {
 		client, clientError = initClient()
 	}
 	return client, clientError
 }
 
-func initClient() (*kubernetes.Clientset, error) {
+// getDynamicClient returns a client for resources without typed clients, e.g.
+// cert-manager's. Like getClient, it returns ctx's error once ctx is done.
+func getDynamicClient(ctx context.Context) (dynamic.Interface, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if dynamicClient == nil && dynamicClientError == nil {
+		dynamicClient, dynamicClientError = initDynamicClient()
+	}
+	return dynamicClient, dynamicClientError
+}
+
+func buildConfig() (*rest.Config, error) {
 	// Create a config from the config file, or a InCluster config if empty.
 	config, err := clientcmd.BuildConfigFromFlags("", *kubeConfig)
 	if err != nil {
 		return nil, errors.Wrap(err, "error building kubernetes config")
 	}
+	return config, nil
+}
+
+func initClient() (kubernetes.Interface, error) {
+	config, err := buildConfig()
+	if err != nil {
+		return nil, err
+	}
 
 	// Create the client.
 	c, err := kubernetes.NewForConfig(config)
@@ -66,107 +97,272 @@ func initClient() (*kubernetes.Clientset, error) {
 	return c, err
 }
 
-func getKubernetesCertificate(csrName string, csr []byte, wantServerAuth bool, allowPrevious bool) ([]byte, error) {
-	client, err := getClient()
+func initDynamicClient() (dynamic.Interface, error) {
+	config, err := buildConfig()
 	if err != nil {
 		return nil, err
 	}
+	c, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating kubernetes dynamic client")
+	}
+	return c, nil
+}
 
+// requestedUsages returns the key usages requested for certificates.
+func requestedUsages(wantServerAuth bool) []certificates.KeyUsage {
 	keyUsages := []certificates.KeyUsage{
 		certificates.UsageDigitalSignature,
-		certificates.UsageKeyEncipherment,
 		certificates.UsageClientAuth,
 	}
+	// Only RSA keys can be used for key encipherment.
+	if *keyAlgorithm == keyAlgorithmRSA {
+		keyUsages = append(keyUsages, certificates.UsageKeyEncipherment)
+	}
 	if wantServerAuth {
 		keyUsages = append(keyUsages, certificates.UsageServerAuth)
 	}
+	return keyUsages
+}
+
+// kubernetesSigner requests certificates through the certificates.k8s.io CSR
+// API. Requests are named after the CSR object.
+type kubernetesSigner struct {
+	csrAPI csrClient
+	// The hostname of this pod, recorded in requesterAnnotation.
+	requester string
+	// The UIDs of the CSRs submitted by name.
+	uids map[string]k8s_types.UID
+}
+
+func newKubernetesSigner(client kubernetes.Interface, requester string) (*kubernetesSigner, error) {
+	csrAPI, err := newCSRClient(client)
+	if err != nil {
+		return nil, err
+	}
+	return &kubernetesSigner{csrAPI: csrAPI, requester: requester, uids: make(map[string]k8s_types.UID)}, nil
+}
+
+// Submit creates the CSR. A previous CSR with the same name was sent for a key
+// we no longer have, so it is replaced if it is no longer needed.
+func (s *kubernetesSigner) Submit(ctx context.Context, csrName string, csr []byte, wantServerAuth bool) error {
+	keyUsages := requestedUsages(wantServerAuth)
+	signer := signerName(wantServerAuth)
+	if err := s.csrAPI.checkSigner(signer, keyUsages); err != nil {
+		return err
+	}
 
 	// Build the certificate signing request.
 	req := &certificates.CertificateSigningRequest{
-		TypeMeta:   types.TypeMeta{Kind: "CertificateSigningRequest"},
-		ObjectMeta: types.ObjectMeta{Name: csrName},
+		TypeMeta: types.TypeMeta{Kind: "CertificateSigningRequest"},
+		ObjectMeta: types.ObjectMeta{
+			Name:        csrName,
+			Annotations: map[string]string{requesterAnnotation: s.requester},
+		},
 		Spec: certificates.CertificateSigningRequestSpec{
-			Request: csr,
-			Usages:  keyUsages,
+			Request:    csr,
+			SignerName: signer,
+			Usages:     keyUsages,
 		},
 	}
 
 	fmt.Printf("Sending create request: %s for %s\n", req.Name, *addresses)
-	resp, err := client.Certificates().CertificateSigningRequests().Create(req)
-
-	if err != nil && k8s_errors.IsAlreadyExists(err) && allowPrevious {
-		fmt.Printf("Attempting to use previous CSR: %s\n", req.Name)
-		getOpts := types.GetOptions{TypeMeta: types.TypeMeta{Kind: "CertificateSigningRequest"}}
-		resp, err = client.Certificates().CertificateSigningRequests().Get(req.Name, getOpts)
+	resp, err := s.csrAPI.create(ctx, req)
+	if k8s_errors.IsAlreadyExists(err) {
+		if err := s.deletePrevious(ctx, csrName); err != nil {
+			return err
+		}
+		resp, err = s.csrAPI.create(ctx, req)
 	}
 	if err != nil {
-		return nil, errors.Wrapf(err, "CertificateSigningRequest.Create(%s) failed", req.Name)
+		return errors.Wrapf(err, "CertificateSigningRequest.Create(%s) failed", req.Name)
 	}
+	s.uids[csrName] = resp.UID
 
 	fmt.Printf("Request sent, waiting for approval. To approve, run 'kubectl certificate approve %s'\n", req.Name)
+	return nil
+}
+
+// deletePrevious deletes the existing CSR named csrName if it was issued, denied
+// or failed, or if this pod sent it. A CSR still pending for another pod is
+// left alone, and an error returned.
+func (s *kubernetesSigner) deletePrevious(ctx context.Context, csrName string) error {
+	csr, err := s.csrAPI.get(ctx, csrName)
+	if err != nil {
+		if k8s_errors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "CertificateSigningRequest.Get(%s) failed", csrName)
+	}
+	conds := getCSRConditions(csr)
+	done := conds.denied != nil || conds.failed != nil || len(csr.Status.Certificate) != 0
+	if requester := csr.Annotations[requesterAnnotation]; !done && requester != s.requester {
+		return errors.Errorf("CSR %s is still pending for %q; approve, deny or delete it first", csrName, requester)
+	}
+	if err := s.csrAPI.delete(ctx, csrName, csr.UID); err != nil && !k8s_errors.IsNotFound(err) {
+		return errors.Wrapf(err, "CertificateSigningRequest.Delete(%s) failed", csrName)
+	}
+	fmt.Printf("Deleted previous CSR: %s\n", csrName)
+	return nil
+}
+
+// Wait watches the CSR until it is approved and issued, denied or failed, for
+// at most --wait-timeout. The watch resumes from the last resourceVersion it
+// saw, and relists if that version is too old.
+func (s *kubernetesSigner) Wait(ctx context.Context, csrName string) ([]byte, error) {
+	uid, ok := s.uids[csrName]
+	if !ok {
+		resp, err := s.csrAPI.get(ctx, csrName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "CertificateSigningRequest.Get(%s) failed", csrName)
+		}
+		uid = resp.UID
+	}
+
+	// Set to 1 once the CSR is approved.
+	var approved int32
+
+	waitCtx, cancel := context.WithTimeout(ctx, *waitTimeout)
+	defer cancel()
+	go printWaiting(waitCtx, func() {
+		if atomic.LoadInt32(&approved) == 1 {
+			fmt.Printf("%s: CSR %s approved, waiting for the certificate to be issued\n", time.Now(), csrName)
+		} else {
+			fmt.Printf("%s: waiting for 'kubectl certificate approve %s'\n", time.Now(), csrName)
+		}
+	})
 
-	// Build the watch request.
-	timeout := int64(watchTimeout.Seconds())
-	watchReq := types.ListOptions{
-		Watch:          true,
-		TimeoutSeconds: &timeout,
-		FieldSelector:  fields.OneTermEqualSelector("metadata.name", csrName).String(),
+	selector := fields.OneTermEqualSelector("metadata.name", csrName).String()
+	lw := &cache.ListWatch{
+		ListFunc: func(options types.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = selector
+			return s.csrAPI.list(waitCtx, options)
+		},
+		WatchFunc: func(options types.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = selector
+			return s.csrAPI.watch(waitCtx, options)
+		},
+	}
+	event, err := watchtools.UntilWithSync(waitCtx, lw, &certificates.CertificateSigningRequest{}, nil,
+		func(event watch.Event) (bool, error) {
+			return checkCSR(event, csrName, uid, &approved)
+		})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.Wrapf(ctx.Err(), "stopped waiting for CSR %s", csrName)
+		}
+		if waitCtx.Err() == context.DeadlineExceeded {
+			return nil, &TimeoutError{Name: csrName, Approved: atomic.LoadInt32(&approved) == 1}
+		}
+		return nil, err
 	}
 
-	resultCh, err := client.Certificates().CertificateSigningRequests().Watch(watchReq)
+	obj := event.Object.(*certificates.CertificateSigningRequest)
+	cond := getCSRConditions(obj).approved
+	fmt.Printf("request %s %s at %s\n", csrName, cond.Type, cond.LastUpdateTime)
+	fmt.Printf("  reason:   %s\n", cond.Reason)
+	fmt.Printf("  message:  %s\n", cond.Message)
+	return obj.Status.Certificate, nil
+}
+
+// CA returns nil: the cluster CA is symlinked from --symlink-ca-from.
+func (s *kubernetesSigner) CA(ctx context.Context, csrName string) ([]byte, error) {
+	return nil, nil
+}
+
+// Cancel deletes the CSR unless it was approved or denied. A CSR left pending
+// would otherwise wait for approval after nobody has the key anymore.
+func (s *kubernetesSigner) Cancel(ctx context.Context, csrName string) error {
+	csr, err := s.csrAPI.get(ctx, csrName)
 	if err != nil {
-		return nil, errors.Wrapf(err, "CertificateSigningRequest.Watch(%s) failed: %v", csrName)
-	}
-
-	watchCh := resultCh.ResultChan()
-	// Loop until we have a cert, CSR is denied, or we timed out. Bail out on errors.
-	for {
-		select {
-		case event, ok := <-watchCh:
-			if !ok {
-				return nil, ChannelError
-			}
-
-			if event.Object.(*certificates.CertificateSigningRequest).UID != resp.UID {
-				// Wrong object.
-				fmt.Printf("received watch notification for object %v, but expected UID=%s\n", event.Object, resp.UID)
-				continue
-			}
-
-			status := event.Object.(*certificates.CertificateSigningRequest).Status
-			if len(status.Conditions) == 0 {
-				continue
-			}
-
-			// TODO(marc): do we need to examine other conditions? For now, we only have approve and deny,
-			// so the latest one should be fine.
-			cond := status.Conditions[len(status.Conditions)-1]
-			if cond.Type != certificates.CertificateApproved {
-				return nil, errors.Errorf("CSR not approved: %+v", status)
-			}
-
-			// This seems to happen: https://github.com/kubernetes/kubernetes/issues/47911
-			if status.Certificate == nil {
-				fmt.Printf("CSR approved, but no certificate in response. Waiting some more\n")
-				continue
-			}
-
-			fmt.Printf("request %s %s at %s\n", req.Name, cond.Type, cond.LastUpdateTime)
-			fmt.Printf("  reason:   %s\n", cond.Reason)
-			fmt.Printf("  message:  %s\n", cond.Message)
-			return status.Certificate, nil
-		case <-time.After(time.Second * 30):
-			// Print a "still waiting" message every 30s.
-			fmt.Printf("%s: waiting for 'kubectl certificate approve %s'\n", time.Now(), req.Name)
-			continue
+		if k8s_errors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "CertificateSigningRequest.Get(%s) failed", csrName)
+	}
+	if uid, ok := s.uids[csrName]; ok && csr.UID != uid {
+		// Replaced by another request-cert.
+		return nil
+	}
+	conds := getCSRConditions(csr)
+	if conds.approved != nil || conds.denied != nil || conds.failed != nil {
+		return nil
+	}
+	if err := s.csrAPI.delete(ctx, csrName, csr.UID); err != nil && !k8s_errors.IsNotFound(err) {
+		return errors.Wrapf(err, "CertificateSigningRequest.Delete(%s) failed", csrName)
+	}
+	fmt.Printf("Deleted pending CSR: %s\n", csrName)
+	return nil
+}
+
+// checkCSR returns true once the CSR in event has been issued, and an error if
+// it was denied, failed or deleted. approved is set once it is approved.
+func checkCSR(event watch.Event, csrName string, uid k8s_types.UID, approved *int32) (bool, error) {
+	obj, ok := event.Object.(*certificates.CertificateSigningRequest)
+	if !ok {
+		fmt.Printf("received unexpected watch notification %v\n", event)
+		return false, nil
+	}
+	if obj.Name != csrName || obj.UID != uid {
+		// Wrong object.
+		fmt.Printf("received watch notification for object %v, but expected UID=%s\n", event.Object, uid)
+		return false, nil
+	}
+	if event.Type == watch.Deleted {
+		return false, errors.Errorf("CSR %s was deleted", csrName)
+	}
+
+	conds := getCSRConditions(obj)
+	switch {
+	case conds.denied != nil:
+		return false, &DeniedError{Name: csrName, Reason: conds.denied.Reason, Message: conds.denied.Message}
+	case conds.failed != nil:
+		return false, &FailedError{Name: csrName, Reason: conds.failed.Reason, Message: conds.failed.Message}
+	case conds.approved == nil:
+		return false, nil
+	case len(obj.Status.Certificate) == 0:
+		// The signer has yet to issue the certificate, or doesn't exist.
+		if atomic.CompareAndSwapInt32(approved, 0, 1) {
+			fmt.Printf("CSR approved, but no certificate issued yet. Waiting for signer %s\n", obj.Spec.SignerName)
 		}
+		return false, nil
 	}
+	return true, nil
+}
+
+// csrConditions are the conditions set on a CSR. A CSR is approved or denied,
+// and may fail to be signed after being approved.
+type csrConditions struct {
+	approved *certificates.CertificateSigningRequestCondition
+	denied   *certificates.CertificateSigningRequestCondition
+	failed   *certificates.CertificateSigningRequestCondition
+}
 
-	return nil, ChannelError
+func getCSRConditions(csr *certificates.CertificateSigningRequest) csrConditions {
+	var conds csrConditions
+	for i := range csr.Status.Conditions {
+		cond := &csr.Status.Conditions[i]
+		// Conditions without a status predate certificates.k8s.io/v1, and are true.
+		if cond.Status != core.ConditionTrue && cond.Status != "" {
+			continue
+		}
+		switch cond.Type {
+		case certificates.CertificateApproved:
+			conds.approved = cond
+		case certificates.CertificateDenied:
+			conds.denied = cond
+		case certificates.CertificateFailed:
+			conds.failed = cond
+		}
+	}
+	return conds
 }
 
-func storeSecrets(secretName string, cert []byte, key []byte) error {
-	client, err := getClient()
+// storeSecrets stores the certificate, key and the signer's CA in a secret,
+// replacing the contents of the secret if it already exists. The CA is left
+// out if the signer provides none.
+func storeSecrets(ctx context.Context, secretName string, cert []byte, key []byte, ca []byte) error {
+	client, err := getClient(ctx)
 	if err != nil {
 		return err
 	}
@@ -177,27 +373,49 @@ func storeSecrets(secretName string, cert []byte, key []byte) error {
 		},
 		Data: map[string][]byte{"cert": cert, "key": key},
 	}
+	if ca != nil {
+		secret.Data["ca"] = ca
+	}
+
+	_, err = client.CoreV1().Secrets(*namespace).Create(ctx, secret, types.CreateOptions{})
+	if !k8s_errors.IsAlreadyExists(err) {
+		return err
+	}
 
-	_, err = client.CoreV1().Secrets(*namespace).Create(secret)
+	existing, err := client.CoreV1().Secrets(*namespace).Get(ctx, secretName, types.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if existing.Data == nil {
+		existing.Data = map[string][]byte{}
+	}
+	existing.Data["cert"] = cert
+	existing.Data["key"] = key
+	if ca != nil {
+		existing.Data["ca"] = ca
+	} else {
+		delete(existing.Data, "ca")
+	}
+	_, err = client.CoreV1().Secrets(*namespace).Update(ctx, existing, types.UpdateOptions{})
 	return err
 }
 
-// getSecrets attempts to lookup the certificate and key from the secrets store.
-// A valid response is nil error and non-nil certificate and key.
-func getSecrets(secretName string) ([]byte, []byte, error) {
-	client, err := getClient()
+// getSecrets attempts to lookup the certificate, key and CA from the secrets
+// store. A valid response is nil error and non-nil certificate and key.
+func getSecrets(ctx context.Context, secretName string) ([]byte, []byte, []byte, error) {
+	client, err := getClient(ctx)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	secret, err := client.Core().Secrets(*namespace).Get(secretName, types.GetOptions{})
+	secret, err := client.CoreV1().Secrets(*namespace).Get(ctx, secretName, types.GetOptions{})
 	if err != nil {
 		if k8s_errors.IsNotFound(err) {
-			return nil, nil, nil
+			return nil, nil, nil, nil
 		}
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	// We let missing fields return nil.
-	return secret.Data["cert"], secret.Data["key"], nil
+	return secret.Data["cert"], secret.Data["key"], secret.Data["ca"], nil
 }
@@ -0,0 +1,278 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	certificates "k8s.io/api/certificates/v1"
+	core "k8s.io/api/core/v1"
+	k8s_errors "k8s.io/apimachinery/pkg/api/errors"
+	types "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testCSRName = "crdb.client.root"
+
+// newTestCSR returns a PEM-encoded CSR for a new ECDSA key.
+func newTestCSR(t *testing.T, template *x509.CertificateRequest) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+// newTestKubernetesSigner returns a kubernetesSigner for pod-0 using a fake
+// clientset serving certificates.k8s.io/v1, holding objs.
+func newTestKubernetesSigner(t *testing.T, objs ...*certificates.CertificateSigningRequest) (*kubernetesSigner, *fake.Clientset) {
+	t.Helper()
+	client := fake.NewSimpleClientset()
+	client.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*types.APIResourceList{
+		{GroupVersion: certificates.SchemeGroupVersion.String()},
+	}
+	for _, obj := range objs {
+		if _, err := client.CertificatesV1().CertificateSigningRequests().Create(
+			context.Background(), obj, types.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := newKubernetesSigner(client, "pod-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, client
+}
+
+func testCSR(requester string, conds ...certificates.CertificateSigningRequestCondition) *certificates.CertificateSigningRequest {
+	csr := &certificates.CertificateSigningRequest{
+		ObjectMeta: types.ObjectMeta{Name: testCSRName, UID: "previous"},
+		Spec: certificates.CertificateSigningRequestSpec{
+			Request:    []byte("previous"),
+			SignerName: certificates.KubeAPIServerClientSignerName,
+		},
+		Status: certificates.CertificateSigningRequestStatus{Conditions: conds},
+	}
+	if requester != "" {
+		csr.Annotations = map[string]string{requesterAnnotation: requester}
+	}
+	return csr
+}
+
+func condition(condType certificates.RequestConditionType) certificates.CertificateSigningRequestCondition {
+	return certificates.CertificateSigningRequestCondition{
+		Type: condType, Status: core.ConditionTrue, Reason: "Test", Message: "by the test",
+	}
+}
+
+func TestKubernetesSignerSubmit(t *testing.T) {
+	issued := testCSR("pod-1", condition(certificates.CertificateApproved))
+	issued.Status.Certificate = []byte("certificate")
+
+	testCases := []struct {
+		name     string
+		previous *certificates.CertificateSigningRequest
+		// replaced is whether the previous CSR is replaced by the new one.
+		replaced bool
+	}{
+		{name: "no previous CSR", replaced: true},
+		{name: "pending for this pod", previous: testCSR("pod-0"), replaced: true},
+		{name: "pending for another pod", previous: testCSR("pod-1")},
+		{name: "pending without requester", previous: testCSR("")},
+		{name: "approved but not issued", previous: testCSR("pod-1", condition(certificates.CertificateApproved))},
+		{name: "issued", previous: issued, replaced: true},
+		{name: "denied", previous: testCSR("pod-1", condition(certificates.CertificateDenied)), replaced: true},
+		{name: "failed", previous: testCSR("pod-1", condition(certificates.CertificateFailed)), replaced: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var objs []*certificates.CertificateSigningRequest
+			if tc.previous != nil {
+				objs = append(objs, tc.previous)
+			}
+			s, client := newTestKubernetesSigner(t, objs...)
+			pemCSR := newTestCSR(t, clientCSR("root"))
+
+			err := s.Submit(context.Background(), testCSRName, pemCSR, false)
+			if tc.replaced && err != nil {
+				t.Fatal(err)
+			} else if !tc.replaced && err == nil {
+				t.Fatal("expected an error replacing another pod's pending CSR")
+			}
+
+			csr, err := client.CertificatesV1().CertificateSigningRequests().Get(
+				context.Background(), testCSRName, types.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tc.replaced {
+				if csr.UID != tc.previous.UID {
+					t.Errorf("previous CSR was deleted")
+				}
+				return
+			}
+			if !bytes.Equal(csr.Spec.Request, pemCSR) {
+				t.Errorf("CSR was not replaced: request is %q", csr.Spec.Request)
+			}
+			if got := csr.Annotations[requesterAnnotation]; got != "pod-0" {
+				t.Errorf("requester annotation is %q, want pod-0", got)
+			}
+			if csr.Spec.SignerName != certificates.KubeAPIServerClientSignerName {
+				t.Errorf("signer is %q, want %q", csr.Spec.SignerName, certificates.KubeAPIServerClientSignerName)
+			}
+		})
+	}
+}
+
+func TestKubernetesSignerWait(t *testing.T) {
+	defer func(timeout time.Duration) { *waitTimeout = timeout }(*waitTimeout)
+	*waitTimeout = 100 * time.Millisecond
+
+	issued := testCSR("pod-0", condition(certificates.CertificateApproved))
+	issued.Status.Certificate = []byte("certificate")
+
+	testCases := []struct {
+		name    string
+		csr     *certificates.CertificateSigningRequest
+		check   func(error) bool
+		want    []byte
+		wantErr string
+	}{
+		{name: "issued", csr: issued, want: []byte("certificate")},
+		{
+			name:    "denied",
+			csr:     testCSR("pod-0", condition(certificates.CertificateDenied)),
+			check:   func(err error) bool { _, ok := err.(*DeniedError); return ok },
+			wantErr: "*DeniedError",
+		},
+		{
+			name:    "failed",
+			csr:     testCSR("pod-0", condition(certificates.CertificateApproved), condition(certificates.CertificateFailed)),
+			check:   func(err error) bool { _, ok := err.(*FailedError); return ok },
+			wantErr: "*FailedError",
+		},
+		{
+			name: "approved but not issued",
+			csr:  testCSR("pod-0", condition(certificates.CertificateApproved)),
+			check: func(err error) bool {
+				timeout, ok := err.(*TimeoutError)
+				return ok && timeout.Approved
+			},
+			wantErr: "an approved *TimeoutError",
+		},
+		{
+			name: "pending",
+			csr:  testCSR("pod-0"),
+			check: func(err error) bool {
+				timeout, ok := err.(*TimeoutError)
+				return ok && !timeout.Approved
+			},
+			wantErr: "a pending *TimeoutError",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := newTestKubernetesSigner(t, tc.csr)
+			got, err := s.Wait(context.Background(), testCSRName)
+			if tc.check != nil {
+				if !tc.check(err) {
+					t.Fatalf("got error %v, want %s", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("got certificate %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestKubernetesSignerCancel(t *testing.T) {
+	testCases := []struct {
+		name    string
+		csr     *certificates.CertificateSigningRequest
+		deleted bool
+	}{
+		{name: "pending", csr: testCSR("pod-0"), deleted: true},
+		{name: "approved", csr: testCSR("pod-0", condition(certificates.CertificateApproved))},
+		{name: "denied", csr: testCSR("pod-0", condition(certificates.CertificateDenied))},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, client := newTestKubernetesSigner(t, tc.csr)
+			if err := s.Cancel(context.Background(), testCSRName); err != nil {
+				t.Fatal(err)
+			}
+			_, err := client.CertificatesV1().CertificateSigningRequests().Get(
+				context.Background(), testCSRName, types.GetOptions{})
+			if deleted := k8s_errors.IsNotFound(err); deleted != tc.deleted {
+				t.Errorf("deleted = %t, want %t (err = %v)", deleted, tc.deleted, err)
+			}
+		})
+	}
+
+	s, _ := newTestKubernetesSigner(t)
+	if err := s.Cancel(context.Background(), testCSRName); err != nil {
+		t.Errorf("canceling a missing CSR: %v", err)
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	defer func(c kubernetes.Interface, ns string) { client, *namespace = c, ns }(client, *namespace)
+	client, *namespace = fake.NewSimpleClientset(), "crdb"
+	ctx := context.Background()
+
+	cert, key, ca, err := getSecrets(ctx, testCSRName)
+	if err != nil || cert != nil || key != nil || ca != nil {
+		t.Fatalf("got %q, %q, %q, %v for a missing secret", cert, key, ca, err)
+	}
+
+	// A CA is only stored if the signer provides one, and is removed when it
+	// no longer does.
+	for _, want := range [][3]string{{"cert", "key", "ca"}, {"new cert", "new key", ""}, {"cert", "key", "new ca"}} {
+		var wantCA []byte
+		if want[2] != "" {
+			wantCA = []byte(want[2])
+		}
+		if err := storeSecrets(ctx, testCSRName, []byte(want[0]), []byte(want[1]), wantCA); err != nil {
+			t.Fatal(err)
+		}
+		cert, key, ca, err := getSecrets(ctx, testCSRName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(cert) != want[0] || string(key) != want[1] || !bytes.Equal(ca, wantCA) {
+			t.Errorf("got %q, %q, %q, want %q", cert, key, ca, want)
+		}
+	}
+}
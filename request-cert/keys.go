@@ -0,0 +1,162 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	keyAlgorithmRSA       = "rsa"
+	keyAlgorithmECDSAP256 = "ecdsa-p256"
+	keyAlgorithmECDSAP384 = "ecdsa-p384"
+	keyAlgorithmEd25519   = "ed25519"
+
+	// keyEncodingPKCS1 is PKCS#1 for RSA keys and SEC1 for ECDSA keys.
+	keyEncodingPKCS1 = "pkcs1"
+	keyEncodingPKCS8 = "pkcs8"
+)
+
+var (
+	keyAlgorithm = flag.String("key-algorithm", keyAlgorithmRSA, "private key algorithm: rsa, ecdsa-p256, ecdsa-p384 or ed25519")
+	keyEncoding  = flag.String("key-encoding", "", "private key encoding: pkcs1 (SEC1 for ECDSA keys) or pkcs8. "+
+		"Defaults to pkcs1, or pkcs8 for ed25519 keys, which have no other encoding")
+)
+
+// checkKeyFlags validates --key-algorithm and --key-encoding.
+func checkKeyFlags() error {
+	switch *keyAlgorithm {
+	case keyAlgorithmRSA, keyAlgorithmECDSAP256, keyAlgorithmECDSAP384, keyAlgorithmEd25519:
+	default:
+		return errors.Errorf("unknown --key-algorithm=%q. Valid algorithms are %q, %q, %q, %q", *keyAlgorithm,
+			keyAlgorithmRSA, keyAlgorithmECDSAP256, keyAlgorithmECDSAP384, keyAlgorithmEd25519)
+	}
+	switch privateKeyEncoding() {
+	case keyEncodingPKCS1:
+		if *keyAlgorithm == keyAlgorithmEd25519 {
+			return errors.New("ed25519 keys can only be encoded as --key-encoding=pkcs8")
+		}
+	case keyEncodingPKCS8:
+	default:
+		return errors.Errorf("unknown --key-encoding=%q. Valid encodings are %q, %q",
+			*keyEncoding, keyEncodingPKCS1, keyEncodingPKCS8)
+	}
+	return nil
+}
+
+func privateKeyEncoding() string {
+	if *keyEncoding != "" {
+		return *keyEncoding
+	}
+	if *keyAlgorithm == keyAlgorithmEd25519 {
+		return keyEncodingPKCS8
+	}
+	return keyEncodingPKCS1
+}
+
+// generateKey returns a new private key for --key-algorithm, and the
+// signature algorithm used to sign CSRs with it.
+func generateKey() (crypto.Signer, x509.SignatureAlgorithm, error) {
+	switch *keyAlgorithm {
+	case keyAlgorithmRSA:
+		key, err := rsa.GenerateKey(rand.Reader, *keySize)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "error generating RSA key pair")
+		}
+		return key, x509.SHA256WithRSA, nil
+	case keyAlgorithmECDSAP256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "error generating ECDSA P-256 key pair")
+		}
+		return key, x509.ECDSAWithSHA256, nil
+	case keyAlgorithmECDSAP384:
+		key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "error generating ECDSA P-384 key pair")
+		}
+		return key, x509.ECDSAWithSHA384, nil
+	case keyAlgorithmEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "error generating Ed25519 key pair")
+		}
+		return key, x509.PureEd25519, nil
+	default:
+		return nil, 0, errors.Errorf("unknown key algorithm %q", *keyAlgorithm)
+	}
+}
+
+// encodeKey returns the PEM encoding of key using --key-encoding.
+func encodeKey(key crypto.Signer) ([]byte, error) {
+	var block *pem.Block
+	if privateKeyEncoding() == keyEncodingPKCS8 {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "error encoding private key as PKCS#8")
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	} else {
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+		case *ecdsa.PrivateKey:
+			der, err := x509.MarshalECPrivateKey(k)
+			if err != nil {
+				return nil, errors.Wrap(err, "error encoding private key as SEC1")
+			}
+			block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+		default:
+			return nil, errors.Errorf("%T keys can only be encoded as PKCS#8", key)
+		}
+	}
+	return pem.EncodeToMemory(block), nil
+}
+
+// parsePrivateKey parses a PEM-encoded PKCS#1, SEC1 or PKCS#8 private key.
+func parsePrivateKey(pemKey []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("no PEM-encoded private key found")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, errors.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setKeyFlags sets --key-algorithm, --key-encoding and --key-size until the
+// test ends.
+func setKeyFlags(t *testing.T, algorithm string, encoding string, size int) {
+	t.Helper()
+	oldAlgorithm, oldEncoding, oldSize := *keyAlgorithm, *keyEncoding, *keySize
+	t.Cleanup(func() { *keyAlgorithm, *keyEncoding, *keySize = oldAlgorithm, oldEncoding, oldSize })
+	*keyAlgorithm, *keyEncoding, *keySize = algorithm, encoding, size
+}
+
+func TestCheckKeyFlags(t *testing.T) {
+	testCases := []struct {
+		algorithm string
+		encoding  string
+		wantErr   bool
+	}{
+		{algorithm: keyAlgorithmRSA},
+		{algorithm: keyAlgorithmRSA, encoding: keyEncodingPKCS8},
+		{algorithm: keyAlgorithmECDSAP256, encoding: keyEncodingPKCS1},
+		{algorithm: keyAlgorithmECDSAP384, encoding: keyEncodingPKCS8},
+		{algorithm: keyAlgorithmEd25519},
+		{algorithm: keyAlgorithmEd25519, encoding: keyEncodingPKCS8},
+		{algorithm: keyAlgorithmEd25519, encoding: keyEncodingPKCS1, wantErr: true},
+		{algorithm: "dsa", wantErr: true},
+		{algorithm: keyAlgorithmRSA, encoding: "der", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.algorithm+"/"+tc.encoding, func(t *testing.T) {
+			setKeyFlags(t, tc.algorithm, tc.encoding, 2048)
+			if err := checkKeyFlags(); (err != nil) != tc.wantErr {
+				t.Errorf("got %v, want error: %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	testCases := []struct {
+		algorithm string
+		encoding  string
+		size      int
+		// The size of the key: RSA modulus or ECDSA curve bits.
+		wantSize          int
+		wantSignature     x509.SignatureAlgorithm
+		wantPEMType       string
+		wantPublicKeyType interface{}
+	}{
+		{
+			algorithm: keyAlgorithmRSA, size: 2048, wantSize: 2048,
+			wantSignature: x509.SHA256WithRSA, wantPEMType: "RSA PRIVATE KEY", wantPublicKeyType: &rsa.PublicKey{},
+		},
+		{
+			algorithm: keyAlgorithmRSA, size: 3072, wantSize: 3072,
+			wantSignature: x509.SHA256WithRSA, wantPEMType: "RSA PRIVATE KEY", wantPublicKeyType: &rsa.PublicKey{},
+		},
+		{
+			algorithm: keyAlgorithmRSA, encoding: keyEncodingPKCS8, size: 2048, wantSize: 2048,
+			wantSignature: x509.SHA256WithRSA, wantPEMType: "PRIVATE KEY", wantPublicKeyType: &rsa.PublicKey{},
+		},
+		{
+			algorithm: keyAlgorithmECDSAP256, wantSize: 256,
+			wantSignature: x509.ECDSAWithSHA256, wantPEMType: "EC PRIVATE KEY", wantPublicKeyType: &ecdsa.PublicKey{},
+		},
+		{
+			algorithm: keyAlgorithmECDSAP256, encoding: keyEncodingPKCS8, wantSize: 256,
+			wantSignature: x509.ECDSAWithSHA256, wantPEMType: "PRIVATE KEY", wantPublicKeyType: &ecdsa.PublicKey{},
+		},
+		{
+			algorithm: keyAlgorithmECDSAP384, wantSize: 384,
+			wantSignature: x509.ECDSAWithSHA384, wantPEMType: "EC PRIVATE KEY", wantPublicKeyType: &ecdsa.PublicKey{},
+		},
+		{
+			algorithm: keyAlgorithmEd25519,
+			// Ed25519 keys default to PKCS#8, their only encoding.
+			wantSignature: x509.PureEd25519, wantPEMType: "PRIVATE KEY", wantPublicKeyType: ed25519.PublicKey{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.algorithm+"/"+tc.encoding, func(t *testing.T) {
+			setKeyFlags(t, tc.algorithm, tc.encoding, tc.size)
+			key, signatureAlgorithm, err := generateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signatureAlgorithm != tc.wantSignature {
+				t.Errorf("got signature algorithm %s, want %s", signatureAlgorithm, tc.wantSignature)
+			}
+			if reflect.TypeOf(key.Public()) != reflect.TypeOf(tc.wantPublicKeyType) {
+				t.Fatalf("got a %T public key, want %T", key.Public(), tc.wantPublicKeyType)
+			}
+			switch pub := key.Public().(type) {
+			case *rsa.PublicKey:
+				if pub.N.BitLen() != tc.wantSize {
+					t.Errorf("got a %d bit RSA key, want %d", pub.N.BitLen(), tc.wantSize)
+				}
+			case *ecdsa.PublicKey:
+				if pub.Curve.Params().BitSize != tc.wantSize {
+					t.Errorf("got a %s key, want %d bits", pub.Curve.Params().Name, tc.wantSize)
+				}
+			}
+
+			pemKey, err := encodeKey(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if block, _ := pem.Decode(pemKey); block == nil || block.Type != tc.wantPEMType {
+				t.Fatalf("got PEM block %+v, want type %q", block, tc.wantPEMType)
+			}
+			parsed, err := parsePrivateKey(pemKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(parsed.Public(), key.Public()) {
+				t.Error("parsed key doesn't match the generated key")
+			}
+
+			// The key can sign a CSR with the returned signature algorithm.
+			template := &x509.CertificateRequest{
+				Subject:            pkix.Name{CommonName: "node"},
+				SignatureAlgorithm: signatureAlgorithm,
+			}
+			der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			csr, err := x509.ParseCertificateRequest(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := csr.CheckSignature(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestEncodeKeyEd25519PKCS1(t *testing.T) {
+	setKeyFlags(t, keyAlgorithmEd25519, keyEncodingPKCS1, 0)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := encodeKey(key); err == nil {
+		t.Error("expected an error encoding an Ed25519 key as PKCS#1")
+	}
+}
+
+func TestParsePrivateKeyErrors(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name   string
+		pemKey []byte
+	}{
+		{name: "not PEM", pemKey: []byte("invalid")},
+		{name: "certificate", pemKey: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ecDER})},
+		{
+			// The PEM type doesn't match the encoding of the key.
+			name:   "SEC1 key in an RSA block",
+			pemKey: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: ecDER}),
+		},
+		{name: "SEC1 key in a PKCS#8 block", pemKey: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecDER})},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parsePrivateKey(tc.pemKey); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+// selfSignedCert returns a PEM-encoded certificate for key.
+func selfSignedCert(t *testing.T, key crypto.Signer) []byte {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestExistingKeyMismatch(t *testing.T) {
+	// A key loaded from an existing secret must be the one the certificate was
+	// issued for, whatever its type.
+	for _, algorithm := range []string{keyAlgorithmRSA, keyAlgorithmECDSAP256, keyAlgorithmECDSAP384, keyAlgorithmEd25519} {
+		t.Run(algorithm, func(t *testing.T) {
+			setKeyFlags(t, algorithm, keyEncodingPKCS8, 2048)
+			certKey, _, err := generateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			otherKey, _, err := generateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			pemKey, err := encodeKey(otherKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "node"}}
+			err = validateCertificate(selfSignedCert(t, certKey), pemKey, nil, template, false)
+			if err == nil || !strings.Contains(err.Error(), "certificate and key don't match") {
+				t.Errorf("got %v, want a key mismatch", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+	certificates "k8s.io/api/certificates/v1"
+	types "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	caSecret     = flag.String("ca-secret", "", "with --signer=local-ca, the secret holding the CA certificate and key")
+	certValidity = flag.Duration("cert-validity", 365*24*time.Hour, "validity of certificates requested from the "+
+		"local-ca, cert-manager and vault signers")
+)
+
+// caSecretKeys are the pairs of certificate and key entries looked up in
+// --ca-secret, in order: the cockroach naming scheme, then kubernetes.io/tls.
+var caSecretKeys = [][2]string{{"ca.crt", "ca.key"}, {"tls.crt", "tls.key"}}
+
+// certificateAuthority signs certificates with a CA loaded from a secret.
+type certificateAuthority struct {
+	pemCert []byte
+	cert    *x509.Certificate
+	key     crypto.Signer
+}
+
+// localCASigner signs CSRs itself with a CA loaded from a secret, for clusters
+// which don't issue certificates through the CSR API.
+type localCASigner struct {
+	ca *certificateAuthority
+	// The certificates signed by request name.
+	certs map[string][]byte
+}
+
+func newLocalCASigner(ctx context.Context, client kubernetes.Interface, secretName string) (*localCASigner, error) {
+	ca, err := loadLocalCA(ctx, client, secretName)
+	if err != nil {
+		return nil, err
+	}
+	return &localCASigner{ca: ca, certs: make(map[string][]byte)}, nil
+}
+
+// Submit signs the CSR right away.
+func (s *localCASigner) Submit(ctx context.Context, name string, pemCSR []byte, wantServerAuth bool) error {
+	pemCert, err := s.ca.sign(pemCSR, wantServerAuth)
+	if err != nil {
+		return err
+	}
+	s.certs[name] = pemCert
+	return nil
+}
+
+// Wait returns the certificate signed by Submit.
+func (s *localCASigner) Wait(ctx context.Context, name string) ([]byte, error) {
+	pemCert, ok := s.certs[name]
+	if !ok {
+		return nil, errors.Errorf("no request %s was submitted", name)
+	}
+	delete(s.certs, name)
+	return pemCert, nil
+}
+
+// CA returns the CA certificate loaded from the secret.
+func (s *localCASigner) CA(ctx context.Context, name string) ([]byte, error) {
+	return s.ca.pemCert, nil
+}
+
+// Cancel does nothing: requests are signed by Submit.
+func (s *localCASigner) Cancel(ctx context.Context, name string) error {
+	return nil
+}
+
+// loadLocalCA reads the CA certificate and key from a secret.
+func loadLocalCA(ctx context.Context, client kubernetes.Interface, secretName string) (*certificateAuthority, error) {
+	secret, err := client.CoreV1().Secrets(*namespace).Get(ctx, secretName, types.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read CA secret %s", secretName)
+	}
+
+	for _, keys := range caSecretKeys {
+		pemCert, pemKey := secret.Data[keys[0]], secret.Data[keys[1]]
+		if pemCert == nil || pemKey == nil {
+			continue
+		}
+		cert, err := parseCertificate(pemCert)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid CA certificate %s in secret %s", keys[0], secretName)
+		}
+		if !cert.IsCA {
+			return nil, errors.Errorf("certificate %s in secret %s is not a CA certificate", keys[0], secretName)
+		}
+		key, err := parsePrivateKey(pemKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid CA key %s in secret %s", keys[1], secretName)
+		}
+		return &certificateAuthority{pemCert: pemCert, cert: cert, key: key}, nil
+	}
+	return nil, errors.Errorf("secret %s has neither ca.crt and ca.key nor tls.crt and tls.key", secretName)
+}
+
+// sign issues a certificate for a PEM-encoded CSR, with the same usages as
+// requested from the Kubernetes CSR API.
+func (ca *certificateAuthority) sign(pemCSR []byte, wantServerAuth bool) ([]byte, error) {
+	block, _ := pem.Decode(pemCSR)
+	if block == nil {
+		return nil, errors.New("no PEM-encoded certificate request found")
+	}
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate request")
+	}
+	if err := req.CheckSignature(); err != nil {
+		return nil, errors.Wrap(err, "invalid certificate request signature")
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating serial number")
+	}
+
+	// Backdate the certificate to tolerate clock skew, but neither predate nor
+	// outlive the CA.
+	now := time.Now()
+	notBefore := now.Add(-time.Hour)
+	if notBefore.Before(ca.cert.NotBefore) {
+		notBefore = ca.cert.NotBefore
+	}
+	notAfter := now.Add(*certValidity)
+	if notAfter.After(ca.cert.NotAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      req.Subject,
+		DNSNames:     req.DNSNames,
+		IPAddresses:  req.IPAddresses,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	template.KeyUsage, template.ExtKeyUsage = x509Usages(requestedUsages(wantServerAuth))
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, req.PublicKey, ca.key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing certificate")
+	}
+	fmt.Printf("Signed certificate for %s with CA %s, valid until %s\n",
+		req.Subject.CommonName, ca.cert.Subject.CommonName, notAfter)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// x509Usages converts the key usages requested from the Kubernetes CSR API to
+// the key usage and extended key usages of an X.509 certificate.
+func x509Usages(usages []certificates.KeyUsage) (x509.KeyUsage, []x509.ExtKeyUsage) {
+	var keyUsage x509.KeyUsage
+	var extKeyUsages []x509.ExtKeyUsage
+	for _, usage := range usages {
+		switch usage {
+		case certificates.UsageDigitalSignature:
+			keyUsage |= x509.KeyUsageDigitalSignature
+		case certificates.UsageKeyEncipherment:
+			keyUsage |= x509.KeyUsageKeyEncipherment
+		case certificates.UsageClientAuth:
+			extKeyUsages = append(extKeyUsages, x509.ExtKeyUsageClientAuth)
+		case certificates.UsageServerAuth:
+			extKeyUsages = append(extKeyUsages, x509.ExtKeyUsageServerAuth)
+		}
+	}
+	return keyUsage, extKeyUsages
+}
@@ -0,0 +1,169 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	core "k8s.io/api/core/v1"
+	types "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestCA returns a PEM-encoded CA certificate valid from notBefore for a
+// day, and its key.
+func newTestCA(t *testing.T, notBefore time.Time, isCA bool) (pemCert []byte, pemKey []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func newTestLocalCASigner(t *testing.T, data map[string][]byte) (*localCASigner, error) {
+	t.Helper()
+	defer func(ns string) { *namespace = ns }(*namespace)
+	*namespace = "crdb"
+	client := fake.NewSimpleClientset(&core.Secret{
+		ObjectMeta: types.ObjectMeta{Name: "ca", Namespace: "crdb"},
+		Data:       data,
+	})
+	return newLocalCASigner(context.Background(), client, "ca")
+}
+
+func TestLocalCASigner(t *testing.T) {
+	// The CA is newer than the hour certificates are backdated by.
+	caNotBefore := time.Now().Add(-time.Minute).Truncate(time.Second)
+	pemCA, pemCAKey := newTestCA(t, caNotBefore, true)
+
+	for _, keys := range caSecretKeys {
+		t.Run(keys[0], func(t *testing.T) {
+			s, err := newTestLocalCASigner(t, map[string][]byte{keys[0]: pemCA, keys[1]: pemCAKey})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			pemCSR := newTestCSR(t, serverCSR([]string{"cockroachdb-0", "10.0.0.1"}))
+			if err := s.Submit(ctx, "crdb.node.cockroachdb-0", pemCSR, true); err != nil {
+				t.Fatal(err)
+			}
+			pemCert, err := s.Wait(ctx, "crdb.node.cockroachdb-0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Wait(ctx, "crdb.node.cockroachdb-0"); err == nil {
+				t.Error("expected an error waiting for the certificate twice")
+			}
+			ca, err := s.CA(ctx, "crdb.node.cockroachdb-0")
+			if err != nil || string(ca) != string(pemCA) {
+				t.Errorf("got CA %q, %v, want the CA from the secret", ca, err)
+			}
+
+			cert, err := parseCertificate(pemCert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cert.NotBefore.Before(caNotBefore) {
+				t.Errorf("certificate is valid from %s, before the CA (%s)", cert.NotBefore, caNotBefore)
+			}
+			if !cert.NotAfter.Equal(caNotBefore.Add(24 * time.Hour)) {
+				t.Errorf("certificate is valid until %s, want the CA's NotAfter", cert.NotAfter)
+			}
+			if err := verifyChain(cert, nil, pemCA, "the test CA"); err != nil {
+				t.Error(err)
+			}
+			for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth} {
+				if !hasExtKeyUsage(cert, usage) {
+					t.Errorf("certificate is missing usage %s", extKeyUsageName(usage))
+				}
+			}
+			if err := cert.VerifyHostname("10.0.0.1"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestLoadLocalCAErrors(t *testing.T) {
+	pemCA, pemCAKey := newTestCA(t, time.Now(), true)
+	pemLeaf, pemLeafKey := newTestCA(t, time.Now(), false)
+	_, otherKey := newTestCA(t, time.Now(), true)
+
+	testCases := []struct {
+		name string
+		data map[string][]byte
+	}{
+		{name: "empty secret"},
+		{name: "no key", data: map[string][]byte{"ca.crt": pemCA}},
+		{name: "not a CA", data: map[string][]byte{"ca.crt": pemLeaf, "ca.key": pemLeafKey}},
+		{name: "invalid certificate", data: map[string][]byte{"ca.crt": []byte("invalid"), "ca.key": pemCAKey}},
+		{name: "invalid key", data: map[string][]byte{"ca.crt": pemCA, "ca.key": []byte("invalid")}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := newTestLocalCASigner(t, tc.data); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	// A key which doesn't match the certificate fails to sign.
+	s, err := newTestLocalCASigner(t, map[string][]byte{"ca.crt": pemCA, "ca.key": otherKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Submit(context.Background(), "crdb.client.root", newTestCSR(t, clientCSR("root")), false); err == nil {
+		t.Error("expected an error signing with a key which doesn't match the CA")
+	}
+}
+
+func TestX509Usages(t *testing.T) {
+	keyUsage, extKeyUsages := x509Usages(requestedUsages(true))
+	if want := x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment; keyUsage != want {
+		t.Errorf("got key usage %v, want %v", keyUsage, want)
+	}
+	if want := []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}; !reflect.DeepEqual(extKeyUsages, want) {
+		t.Errorf("got extended key usages %v, want %v", extKeyUsages, want)
+	}
+}
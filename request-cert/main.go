@@ -17,20 +17,23 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/cockroachdb/k8s/request-cert/atomicfile"
 	"github.com/pkg/errors"
 )
 
@@ -42,35 +45,82 @@ var (
 
 	namespace       = flag.String("namespace", "", "kubernetes namespace for this pod")
 	certsDir        = flag.String("certs-dir", "cockroach-certs", "certs directory")
-	keySize         = flag.Int("key-size", 2048, "RSA key size in bits")
+	keySize         = flag.Int("key-size", 2048, "RSA key size in bits, for --key-algorithm=rsa")
 	symlinkCASource = flag.String("symlink-ca-from", "", "if non-empty, create <certs-dir>/ca.crt linking to this file")
+	keyMode         = flag.String("key-mode", "0400", "octal permission bits of the written key file")
+	certMode        = flag.String("cert-mode", "0644", "octal permission bits of the written certificate file")
+	fileOwner       = flag.String("file-owner", "", "if non-empty, numeric <uid>:<gid> owning the written files")
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		runGC(os.Args[2:])
+		return
+	}
 	flag.Parse()
-	flag.Lookup("logtostderr").Value.Set("true")
 
 	// Validate flags.
 	if len(*namespace) == 0 {
 		log.Fatal("--namespace is required and must not be empty")
 	}
+	keyOpts, certOpts, err := fileOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := checkKeyFlags(); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkValidationFlags(); err != nil {
+		log.Fatal(err)
+	}
 
-	// Check certificate type.
-	var template *x509.CertificateRequest
-	var filename, csrName string
-	var wantServerAuth bool
+	// Stop waiting for the certificate when the pod is deleted.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
 
 	hostname, err := os.Hostname()
 	if err != nil || len(hostname) == 0 {
 		log.Fatalf("could not determine hostname. got: %q, err=%v", hostname, err)
 	}
 
+	signer, err := newSigner(ctx, hostname)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Check certificate type.
+	var template *x509.CertificateRequest
+	// validation is the template a certificate found in a secret is checked
+	// against. It leaves out SANs which change whenever the pod restarts.
+	var validation *x509.CertificateRequest
+	var filename, csrName string
+	var wantServerAuth bool
+
 	switch *certificateType {
 	case "node":
-		if len(*addresses) == 0 {
+		var hosts, podIPs []string
+		if len(*addresses) != 0 {
+			hosts = strings.Split(*addresses, ",")
+		}
+		if *discoverAddresses {
+			name := *podName
+			if name == "" {
+				name = hostname
+			}
+			client, err := getClient(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+			hosts, podIPs, err = discoverSANs(ctx, client, name, hosts)
+			if err != nil {
+				log.Fatalf("failed to discover addresses: %v", err)
+			}
+			log.Printf("Discovered addresses: %s\n", strings.Join(append(hosts, podIPs...), ","))
+		} else if len(hosts) == 0 {
 			log.Fatal("node certificate requested, but --addresses is empty")
 		}
-		template = serverCSR(strings.Split(*addresses, ","))
+		validation = serverCSR(hosts)
+		template = serverCSR(append(hosts, podIPs...))
 
 		// Certificate name for nodes must include a node identifier. We use the hostname.
 		// The CSR name is the same.
@@ -82,6 +132,7 @@ func main() {
 			log.Fatal("client certificate requested, but --user is empty")
 		}
 		template = clientCSR(*user)
+		validation = template
 
 		// Certificate name for clients must only include the username.
 		// Include the hostname in the CSR name.
@@ -92,50 +143,80 @@ func main() {
 	}
 
 	log.Printf("Looking up cert and key under secret %s\n", csrName)
-	pemCert, pemKey, err := getSecrets(csrName)
+	pemCert, pemKey, storedCA, err := getSecrets(ctx, csrName)
 	if err != nil {
 		log.Fatalf("failed to read from secrets: %v", err)
 	}
 
+	var pemCA []byte
 	if pemCert == nil || pemKey == nil {
 		log.Printf("Secret %s not found, sending CSR\n", csrName)
-		pemCert, pemKey, err = requestCertificate(csrName, template, wantServerAuth)
+		pemCert, pemKey, err = requestCertificate(ctx, signer, csrName, template, wantServerAuth)
+		if err != nil {
+			fatalCertificateError("failed to get certificate", err)
+		}
+		// Some signers only return their CA with a new certificate.
+		pemCA, err = signer.CA(ctx, csrName)
 		if err != nil {
-			log.Fatalf("failed to get certificate: %v", err)
+			log.Fatalf("failed to get CA certificate: %v", err)
 		}
 
 		log.Printf("Storing cert and key under secret %s\n", csrName)
-		if err := storeSecrets(csrName, pemCert, pemKey); err != nil {
+		if err := storeSecrets(ctx, csrName, pemCert, pemKey, pemCA); err != nil {
 			log.Fatalf("could not store secrets: %v", err)
 		}
+	} else {
+		// Get the CA to validate the stored certificate against.
+		pemCA, err = signerCA(ctx, signer, csrName, storedCA)
+		if err != nil {
+			log.Fatalf("failed to get CA certificate: %v", err)
+		}
+		reason, err := secretRenewalReason(pemCert, pemKey, pemCA, validation, wantServerAuth)
+		if err != nil {
+			log.Fatalf("certificate in secret %s is invalid: %v", csrName, err)
+		}
+		if reason != "" {
+			log.Printf("Certificate in secret %s %s, sending CSR\n", csrName, reason)
+			oldCert := pemCert
+			pemCert, pemKey, pemCA, err = renewCertificate(ctx, signer, csrName, template, wantServerAuth)
+			if err != nil {
+				fatalCertificateError("failed to renew certificate", err)
+			}
+			log.Printf("Renewed certificate in secret %s: old NotAfter %s, new NotAfter %s\n",
+				csrName, notAfter(oldCert), notAfter(pemCert))
+		}
 	}
 
 	log.Print("Writing cert and key to local files\n")
-	if err := writeFiles(filename, pemCert, pemKey); err != nil {
+	if err := writeFiles(filename, pemCert, pemKey, pemCA, keyOpts, certOpts); err != nil {
 		log.Fatalf("failed to write files: %v", err)
 	}
+
+	if *rotate {
+		rotateCertificate(ctx, signer, filename, csrName, template, wantServerAuth, keyOpts, certOpts)
+	}
 }
 
-// requestCertificate builds a CSR and send its for approval.
+// requestCertificate builds a CSR and sends it to signer.
 // If approved, it will return the pem-encoded certificate and key, otherwise it returns an error.
+// If ctx is canceled while waiting, the request is deleted with --delete-request-on-exit.
 func requestCertificate(
-	csrName string, template *x509.CertificateRequest, wantServerAuth bool,
+	ctx context.Context, signer Signer, csrName string, template *x509.CertificateRequest, wantServerAuth bool,
 ) ([]byte, []byte, error) {
 	// Generate a new private key.
-	privateKey, err := rsa.GenerateKey(rand.Reader, *keySize)
+	privateKey, signatureAlgorithm, err := generateKey()
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "error generating RSA key pair")
+		return nil, nil, err
 	}
 
 	// Convert key to PEM.
-	pemKey := pem.EncodeToMemory(
-		&pem.Block{
-			Type:  "RSA PRIVATE KEY",
-			Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-		},
-	)
+	pemKey, err := encodeKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Create CSR.
+	template.SignatureAlgorithm = signatureAlgorithm
 	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, template, privateKey)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "error creating certificate request")
@@ -150,17 +231,31 @@ func requestCertificate(
 	)
 
 	// Send CSR for approval and certificate generation.
-	pemCert, err := getKubernetesCertificate(csrName, pemCSR, wantServerAuth, false)
-	for i := 0; i < 10 && err == ChannelError; i++ {
-		pemCert, err = getKubernetesCertificate(csrName, pemCSR, wantServerAuth, true)
+	if err := signer.Submit(ctx, csrName, pemCSR, wantServerAuth); err != nil {
+		return nil, nil, err
 	}
+	pemCert, err := signer.Wait(ctx, csrName)
 	if err != nil {
+		if ctx.Err() != nil && *deleteRequestOnExit {
+			cancelRequest(signer, csrName)
+		}
 		return nil, nil, err
 	}
 
 	return pemCert, pemKey, nil
 }
 
+// cancelRequest deletes the pending request submitted under csrName, so the
+// next run doesn't find it. It uses its own context, as the one used to wait
+// for the request was canceled.
+func cancelRequest(signer Signer, csrName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := signer.Cancel(ctx, csrName); err != nil {
+		log.Printf("failed to delete request %s: %v\n", csrName, err)
+	}
+}
+
 // serverCSR generates a certificate signing request for a server certificate and returns it.
 // Takes in the list of hosts/ip addresses this certificate applies to.
 func serverCSR(hosts []string) *x509.CertificateRequest {
@@ -195,7 +290,35 @@ func clientCSR(user string) *x509.CertificateRequest {
 	}
 }
 
-func writeFiles(filePrefix string, pemCert []byte, pemKey []byte) error {
+// fileOptions returns the options for writing the key and certificate files.
+func fileOptions() (keyOpts atomicfile.Options, certOpts atomicfile.Options, err error) {
+	keyOpts.Mode, err = atomicfile.ParseMode(*keyMode)
+	if err != nil {
+		return keyOpts, certOpts, errors.Wrap(err, "invalid --key-mode")
+	}
+	certOpts.Mode, err = atomicfile.ParseMode(*certMode)
+	if err != nil {
+		return keyOpts, certOpts, errors.Wrap(err, "invalid --cert-mode")
+	}
+	owner, err := atomicfile.ParseOwner(*fileOwner)
+	if err != nil {
+		return keyOpts, certOpts, errors.Wrap(err, "invalid --file-owner")
+	}
+	keyOpts.Owner = owner
+	certOpts.Owner = owner
+	return keyOpts, certOpts, nil
+}
+
+// writeFiles writes the key and certificate to --certs-dir. The CA certificate
+// is written if pemCA is non-nil, or else symlinked from --symlink-ca-from.
+func writeFiles(
+	filePrefix string,
+	pemCert []byte,
+	pemKey []byte,
+	pemCA []byte,
+	keyOpts atomicfile.Options,
+	certOpts atomicfile.Options,
+) error {
 	// Make directory, but don't fail if it exists.
 	if err := os.MkdirAll(*certsDir, 0755); err != nil {
 		return errors.Wrapf(err, "could not create directory %s", *certsDir)
@@ -203,19 +326,26 @@ func writeFiles(filePrefix string, pemCert []byte, pemKey []byte) error {
 
 	// Encode and write key.
 	keyPath := filepath.Join(*certsDir, filePrefix+".key")
-	if err := ioutil.WriteFile(keyPath, pemKey, 0400); err != nil {
+	if err := atomicfile.WriteFile(keyPath, pemKey, keyOpts); err != nil {
 		return errors.Wrapf(err, "could not write private key file %s", keyPath)
 	}
 	fmt.Printf("wrote key file: %s\n", keyPath)
 
 	// Write certificate.
 	certPath := filepath.Join(*certsDir, filePrefix+".crt")
-	if err := ioutil.WriteFile(certPath, pemCert, 0644); err != nil {
+	if err := atomicfile.WriteFile(certPath, pemCert, certOpts); err != nil {
 		return errors.Wrapf(err, "could not write certificate file %s", certPath)
 	}
 	fmt.Printf("wrote certificate file: %s\n", certPath)
 
-	if len(*symlinkCASource) != 0 {
+	if pemCA != nil {
+		// Write the signer's CA certificate.
+		caPath := filepath.Join(*certsDir, "ca.crt")
+		if err := atomicfile.WriteFile(caPath, pemCA, certOpts); err != nil {
+			return errors.Wrapf(err, "could not write CA certificate file %s", caPath)
+		}
+		fmt.Printf("wrote CA certificate file: %s\n", caPath)
+	} else if len(*symlinkCASource) != 0 {
 		// Symlink CA certificate. First ensure there isn't already a file at the
 		// link destination because symlink is not idempotent.
 		linkDest := filepath.Join(*certsDir, "ca.crt")
@@ -0,0 +1,86 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var renewBefore = flag.Duration("renew-before", 7*24*time.Hour,
+	"request a new certificate if the stored one expires within this duration")
+
+// parseCertificate parses the first certificate in pemCert.
+func parseCertificate(pemCert []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(pemCert)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM-encoded certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate")
+	}
+	return cert, nil
+}
+
+// needsRenewal returns a description of why pemCert needs to be replaced, or
+// an empty string if it can still be used.
+func needsRenewal(pemCert []byte, now time.Time) string {
+	cert, err := parseCertificate(pemCert)
+	if err != nil {
+		return fmt.Sprintf("could not be parsed: %v", err)
+	}
+	if !now.Before(cert.NotAfter) {
+		return fmt.Sprintf("expired at %s", cert.NotAfter)
+	}
+	if remaining := cert.NotAfter.Sub(now); remaining < *renewBefore {
+		return fmt.Sprintf("expires at %s, in less than --renew-before=%s", cert.NotAfter, *renewBefore)
+	}
+	return ""
+}
+
+// notAfter returns the expiry of pemCert for logging.
+func notAfter(pemCert []byte) string {
+	cert, err := parseCertificate(pemCert)
+	if err != nil {
+		return "unknown"
+	}
+	return cert.NotAfter.String()
+}
+
+// renewCertificate requests a new certificate and replaces the contents of the
+// secret with it. It returns the certificate, key and the signer's CA.
+func renewCertificate(
+	ctx context.Context, signer Signer, csrName string, template *x509.CertificateRequest, wantServerAuth bool,
+) ([]byte, []byte, []byte, error) {
+	pemCert, pemKey, err := requestCertificate(ctx, signer, csrName, template, wantServerAuth)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to get certificate")
+	}
+	pemCA, err := signer.CA(ctx, csrName)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to get CA certificate")
+	}
+	if err := storeSecrets(ctx, csrName, pemCert, pemKey, pemCA); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "could not store secrets")
+	}
+	return pemCert, pemKey, pemCA, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNeedsRenewal(t *testing.T) {
+	defer func(d time.Duration) { *renewBefore = d }(*renewBefore)
+	*renewBefore = time.Hour
+
+	notBefore := time.Now().Truncate(time.Second)
+	pemCert, _ := newTestCA(t, notBefore, false)
+	expiry := notBefore.Add(24 * time.Hour)
+
+	testCases := []struct {
+		name    string
+		pemCert []byte
+		now     time.Time
+		// A substring of the reason, or "" if the certificate can be used.
+		want string
+	}{
+		{name: "new", pemCert: pemCert, now: notBefore},
+		{name: "before the threshold", pemCert: pemCert, now: expiry.Add(-time.Hour - time.Nanosecond)},
+		{name: "at the threshold", pemCert: pemCert, now: expiry.Add(-time.Hour)},
+		{name: "after the threshold", pemCert: pemCert, now: expiry.Add(-time.Hour + time.Nanosecond), want: "in less than --renew-before=1h0m0s"},
+		{name: "just before expiry", pemCert: pemCert, now: expiry.Add(-time.Nanosecond), want: "in less than --renew-before"},
+		{name: "at expiry", pemCert: pemCert, now: expiry, want: "expired at"},
+		{name: "expired", pemCert: pemCert, now: expiry.Add(24 * time.Hour), want: "expired at"},
+		{name: "invalid", pemCert: []byte("invalid"), now: notBefore, want: "could not be parsed"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := needsRenewal(tc.pemCert, tc.now)
+			if (tc.want == "") != (got == "") || !strings.Contains(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNotAfter(t *testing.T) {
+	notBefore := time.Now().Truncate(time.Second)
+	pemCert, _ := newTestCA(t, notBefore, false)
+	if got, want := notAfter(pemCert), notBefore.Add(24*time.Hour).UTC().String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := notAfter([]byte("invalid")); got != "unknown" {
+		t.Errorf("got %q for an invalid certificate, want %q", got, "unknown")
+	}
+}
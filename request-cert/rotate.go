@@ -0,0 +1,130 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cockroachdb/k8s/request-cert/atomicfile"
+	"github.com/pkg/errors"
+)
+
+var (
+	rotate              = flag.Bool("rotate", false, "keep running after writing the certificate, and rotate it before it expires")
+	rotateCheckInterval = flag.Duration("rotate-check-interval", time.Hour,
+		"with --rotate, how often to check the expiry of the certificate in --certs-dir")
+	sighupProcess = flag.String("sighup-process", "", "with --rotate, send SIGHUP to processes with this name "+
+		"after rotating the certificate. Requires shareProcessNamespace in the pod spec")
+)
+
+// rotateCertificate periodically checks the certificate written to
+// --certs-dir, and replaces it and the secret when it needs renewal. It returns
+// once ctx is done; errors are logged and retried at the next check.
+func rotateCertificate(
+	ctx context.Context,
+	signer Signer,
+	filename string,
+	csrName string,
+	template *x509.CertificateRequest,
+	wantServerAuth bool,
+	keyOpts atomicfile.Options,
+	certOpts atomicfile.Options,
+) {
+	certPath := filepath.Join(*certsDir, filename+".crt")
+	log.Printf("Checking %s for rotation every %s\n", certPath, *rotateCheckInterval)
+
+	ticker := time.NewTicker(*rotateCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Printf("Stopped rotating %s: %v\n", certPath, ctx.Err())
+			return
+		}
+
+		pemCert, err := ioutil.ReadFile(certPath)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("could not read %s: %v\n", certPath, err)
+			continue
+		}
+		reason := "does not exist"
+		if pemCert != nil {
+			reason = needsRenewal(pemCert, time.Now())
+		}
+		if reason == "" {
+			continue
+		}
+
+		log.Printf("Certificate %s %s, rotating\n", certPath, reason)
+		newCert, newKey, pemCA, err := renewCertificate(ctx, signer, csrName, template, wantServerAuth)
+		if err != nil {
+			log.Printf("failed to rotate certificate: %v\n", err)
+			continue
+		}
+		if err := writeFiles(filename, newCert, newKey, pemCA, keyOpts, certOpts); err != nil {
+			log.Printf("failed to write files: %v\n", err)
+			continue
+		}
+		log.Printf("Rotated certificate %s: old NotAfter %s, new NotAfter %s\n",
+			certPath, notAfter(pemCert), notAfter(newCert))
+
+		if *sighupProcess != "" {
+			if err := signalProcesses(*sighupProcess, syscall.SIGHUP); err != nil {
+				log.Printf("failed to send SIGHUP to %s: %v\n", *sighupProcess, err)
+			}
+		}
+	}
+}
+
+// signalProcesses sends sig to every process named name, as listed in /proc.
+// It returns an error if no process was found.
+func signalProcesses(name string, sig syscall.Signal) error {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return errors.Wrap(err, "could not list processes")
+	}
+	self := os.Getpid()
+	var found bool
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		comm, err := ioutil.ReadFile(filepath.Join("/proc", entry.Name(), "comm"))
+		if err != nil || strings.TrimSpace(string(comm)) != name {
+			continue
+		}
+		found = true
+		if err := syscall.Kill(pid, sig); err != nil {
+			return errors.Wrapf(err, "could not signal process %d", pid)
+		}
+		log.Printf("Sent %s to %s (pid %d)\n", sig, name, pid)
+	}
+	if !found {
+		return errors.Errorf("no process named %q found", name)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/k8s/request-cert/atomicfile"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRotateCertificate(t *testing.T) {
+	pemCA, pemCAKey := newTestCA(t, time.Now().Add(-time.Minute), true)
+	signer, err := newTestLocalCASigner(t, map[string][]byte{"ca.crt": pemCA, "ca.key": pemCAKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(c kubernetes.Interface, ns string, dir string, interval, before time.Duration, algorithm string) {
+		client, *namespace, *certsDir, *rotateCheckInterval, *renewBefore, *keyAlgorithm = c, ns, dir, interval, before, algorithm
+	}(client, *namespace, *certsDir, *rotateCheckInterval, *renewBefore, *keyAlgorithm)
+	client, *namespace, *certsDir = fake.NewSimpleClientset(), "crdb", t.TempDir()
+	*rotateCheckInterval, *renewBefore, *keyAlgorithm = 10*time.Millisecond, time.Hour, keyAlgorithmECDSAP256
+
+	// The current certificate expires in half an hour.
+	oldCert, oldKey := newTestCA(t, time.Now().Add(-23*time.Hour-30*time.Minute), false)
+	opts := atomicfile.Options{Mode: 0600}
+	if err := writeFiles("node", oldCert, oldKey, nil, opts, opts); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := storeSecrets(ctx, testCSRName, oldCert, oldKey, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		rotateCertificate(ctx, signer, "node", testCSRName, serverCSR([]string{"cockroachdb-0"}), true, opts, opts)
+		close(done)
+	}()
+
+	read := func(name string) []byte {
+		b, err := ioutil.ReadFile(filepath.Join(*certsDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	for deadline := time.Now().Add(5 * time.Second); reflect.DeepEqual(read("node.crt"), oldCert); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the certificate to be rotated")
+		}
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("rotateCertificate didn't return after the context was canceled")
+	}
+
+	newCert, newKey := read("node.crt"), read("node.key")
+	if reflect.DeepEqual(newKey, oldKey) {
+		t.Fatal("the key wasn't replaced")
+	}
+	// The new certificate is for a new key pair, not the old key.
+	if _, err := tls.X509KeyPair(newCert, newKey); err != nil {
+		t.Errorf("new certificate and key don't match: %v", err)
+	}
+	if _, err := tls.X509KeyPair(newCert, oldKey); err == nil {
+		t.Error("the new certificate was issued for the old key")
+	}
+	if reason := needsRenewal(newCert, time.Now()); reason != "" {
+		t.Errorf("new certificate %s", reason)
+	}
+	if ca := read("ca.crt"); !reflect.DeepEqual(ca, pemCA) {
+		t.Errorf("got CA %q, want the signer's CA", ca)
+	}
+
+	cert, key, ca, err := getSecrets(context.Background(), testCSRName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cert, newCert) || !reflect.DeepEqual(key, newKey) || !reflect.DeepEqual(ca, pemCA) {
+		t.Error("the secret wasn't updated with the new certificate, key and CA")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	types "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const defaultClusterDomain = "cluster.local"
+
+var (
+	discoverAddresses = flag.Bool("discover-addresses", false, "for node certificates, discover the SANs from the pod "+
+		"and the Services selecting it; --addresses are added to them")
+	podName = flag.String("pod-name", os.Getenv("POD_NAME"), "with --discover-addresses, the name of this pod; "+
+		"defaults to $POD_NAME, or the hostname")
+	podIP = flag.String("pod-ip", os.Getenv("POD_IP"), "with --discover-addresses, comma-separated IPs of this pod; "+
+		"defaults to $POD_IP, or the IPs in the pod's status")
+	clusterDomain = flag.String("cluster-domain", "", "with --discover-addresses, the cluster domain; "+
+		"defaults to the one in /etc/resolv.conf, or "+defaultClusterDomain)
+)
+
+// discoverSANs returns the DNS names and IP addresses the pod can be reached
+// at: its hostname and FQDN under its headless Service, the names of the
+// Services selecting it, localhost and extra. These match the names
+// locality-checker's csr-approver allows. The pod's IPs are returned
+// separately, as they change whenever the pod is restarted.
+func discoverSANs(
+	ctx context.Context, client kubernetes.Interface, name string, extra []string,
+) (sans []string, podIPs []string, err error) {
+	pod, err := client.CoreV1().Pods(*namespace).Get(ctx, name, types.GetOptions{})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not get pod %s", name)
+	}
+	domain := *clusterDomain
+	if domain == "" {
+		domain = resolvConfClusterDomain("/etc/resolv.conf", *namespace)
+	}
+
+	seen := make(map[string]bool)
+	add := func(names ...string) {
+		for _, name := range names {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				sans = append(sans, name)
+			}
+		}
+	}
+
+	hostname := pod.Spec.Hostname
+	if hostname == "" {
+		hostname = pod.Name
+	}
+	add(hostname)
+
+	services, err := client.CoreV1().Services(pod.Namespace).List(ctx, types.ListOptions{})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "could not list services in %s", pod.Namespace)
+	}
+	for _, svc := range services.Items {
+		if svc.Name == pod.Spec.Subdomain && svc.Spec.ClusterIP == core.ClusterIPNone {
+			add(serviceNames(hostname+"."+svc.Name, pod.Namespace, domain)...)
+		}
+	}
+	for _, svc := range services.Items {
+		if svc.Spec.ClusterIP == core.ClusterIPNone || len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		if labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(pod.Labels)) {
+			add(serviceNames(svc.Name, pod.Namespace, domain)...)
+		}
+	}
+
+	add("localhost", "127.0.0.1")
+	add(extra...)
+
+	ips := []string{pod.Status.PodIP}
+	for _, ip := range pod.Status.PodIPs {
+		ips = append(ips, ip.IP)
+	}
+	if *podIP != "" {
+		ips = strings.Split(*podIP, ",")
+	}
+	for _, ip := range ips {
+		if ip != "" && !seen[ip] {
+			seen[ip] = true
+			podIPs = append(podIPs, ip)
+		}
+	}
+	return sans, podIPs, nil
+}
+
+// serviceNames returns the short, namespaced and cluster-domain forms of a
+// Service name.
+func serviceNames(name string, namespace string, domain string) []string {
+	return []string{
+		name,
+		fmt.Sprintf("%s.%s", name, namespace),
+		fmt.Sprintf("%s.%s.svc", name, namespace),
+		fmt.Sprintf("%s.%s.svc.%s", name, namespace, domain),
+	}
+}
+
+// resolvConfClusterDomain returns the cluster domain from the
+// <namespace>.svc.<domain> search domain the kubelet adds to pods'
+// resolv.conf, or the default cluster domain.
+func resolvConfClusterDomain(path string, namespace string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return defaultClusterDomain
+	}
+	defer f.Close()
+
+	prefix := namespace + ".svc."
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "search" {
+			continue
+		}
+		for _, domain := range fields[1:] {
+			if strings.HasPrefix(domain, prefix) {
+				return strings.TrimSuffix(strings.TrimPrefix(domain, prefix), ".")
+			}
+		}
+	}
+	return defaultClusterDomain
+}
@@ -0,0 +1,133 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	types "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiscoverSANs(t *testing.T) {
+	defer func(ns, domain, ip string) { *namespace, *clusterDomain, *podIP = ns, domain, ip }(*namespace, *clusterDomain, *podIP)
+	*namespace, *clusterDomain, *podIP = "crdb", "example.org", ""
+
+	service := func(name string, clusterIP string, selector map[string]string) *core.Service {
+		return &core.Service{
+			ObjectMeta: types.ObjectMeta{Namespace: "crdb", Name: name},
+			Spec:       core.ServiceSpec{ClusterIP: clusterIP, Selector: selector},
+		}
+	}
+	app := map[string]string{"app": "cockroachdb"}
+	client := fake.NewSimpleClientset(
+		&core.Pod{
+			ObjectMeta: types.ObjectMeta{Namespace: "crdb", Name: "cockroachdb-0", Labels: app},
+			Spec:       core.PodSpec{Hostname: "cockroachdb-0", Subdomain: "cockroachdb"},
+			Status: core.PodStatus{
+				PodIP:  "10.0.0.5",
+				PodIPs: []core.PodIP{{IP: "10.0.0.5"}, {IP: "fd00::5"}},
+			},
+		},
+		service("cockroachdb", core.ClusterIPNone, app),
+		service("cockroachdb-public", "10.96.0.10", app),
+		service("other", "10.96.0.11", map[string]string{"app": "other"}),
+		service("no-selector", "10.96.0.12", nil),
+		&core.Service{
+			ObjectMeta: types.ObjectMeta{Namespace: "other", Name: "cockroachdb-public"},
+			Spec:       core.ServiceSpec{ClusterIP: "10.96.0.13", Selector: app},
+		},
+	)
+
+	sans, podIPs, err := discoverSANs(context.Background(), client, "cockroachdb-0", []string{"db.example.com", "localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSANs := []string{
+		"cockroachdb-0",
+		"cockroachdb-0.cockroachdb",
+		"cockroachdb-0.cockroachdb.crdb",
+		"cockroachdb-0.cockroachdb.crdb.svc",
+		"cockroachdb-0.cockroachdb.crdb.svc.example.org",
+		"cockroachdb-public",
+		"cockroachdb-public.crdb",
+		"cockroachdb-public.crdb.svc",
+		"cockroachdb-public.crdb.svc.example.org",
+		"localhost",
+		"127.0.0.1",
+		"db.example.com",
+	}
+	if !reflect.DeepEqual(sans, wantSANs) {
+		t.Errorf("got SANs %q, want %q", sans, wantSANs)
+	}
+	if want := []string{"10.0.0.5", "fd00::5"}; !reflect.DeepEqual(podIPs, want) {
+		t.Errorf("got pod IPs %q, want %q", podIPs, want)
+	}
+
+	// --pod-ip overrides the pod's status.
+	*podIP = "10.0.0.6"
+	if _, podIPs, err = discoverSANs(context.Background(), client, "cockroachdb-0", nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"10.0.0.6"}; !reflect.DeepEqual(podIPs, want) {
+		t.Errorf("got pod IPs %q with --pod-ip, want %q", podIPs, want)
+	}
+
+	if _, _, err := discoverSANs(context.Background(), client, "cockroachdb-9", nil); err == nil {
+		t.Error("expected an error for a missing pod")
+	}
+}
+
+func TestDiscoverSANsWithoutHeadlessService(t *testing.T) {
+	defer func(ns, domain string) { *namespace, *clusterDomain = ns, domain }(*namespace, *clusterDomain)
+	*namespace, *clusterDomain = "crdb", "cluster.local"
+
+	// The pod's subdomain only resolves if a headless Service of that name
+	// exists.
+	client := fake.NewSimpleClientset(&core.Pod{
+		ObjectMeta: types.ObjectMeta{Namespace: "crdb", Name: "cockroachdb-0"},
+		Spec:       core.PodSpec{Subdomain: "cockroachdb"},
+	})
+	sans, _, err := discoverSANs(context.Background(), client, "cockroachdb-0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"cockroachdb-0", "localhost", "127.0.0.1"}; !reflect.DeepEqual(sans, want) {
+		t.Errorf("got SANs %q, want %q", sans, want)
+	}
+}
+
+func TestResolvConfClusterDomain(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "resolv.conf")
+	conf := "nameserver 10.96.0.10\nsearch crdb.svc.example.org svc.example.org example.org\noptions ndots:5\n"
+	if err := ioutil.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := resolvConfClusterDomain(path, "crdb"); got != "example.org" {
+		t.Errorf("got %q, want %q", got, "example.org")
+	}
+	if got := resolvConfClusterDomain(path, "other"); got != defaultClusterDomain {
+		t.Errorf("got %q for another namespace, want %q", got, defaultClusterDomain)
+	}
+	if got := resolvConfClusterDomain(filepath.Join(dir, "missing"), "crdb"); got != defaultClusterDomain {
+		t.Errorf("got %q for a missing file, want %q", got, defaultClusterDomain)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	signerKubernetes  = "kubernetes"
+	signerLocalCA     = "local-ca"
+	signerCertManager = "cert-manager"
+	signerVault       = "vault"
+)
+
+var waitTimeout = flag.Duration("wait-timeout", time.Hour, "how long to wait for a certificate to be issued")
+
+var deleteRequestOnExit = flag.Bool("delete-request-on-exit", false, "on SIGTERM or SIGINT while waiting for "+
+	"a certificate, delete the request unless it was already approved or denied")
+
+// requesterAnnotation is set on the requests request-cert creates to the
+// hostname of the pod which sent them. A pending request is only replaced by
+// the pod which sent it: requests for client certificates are shared by all
+// pods, and deleting another pod's request would fail its wait.
+const requesterAnnotation = "request-cert.cockroachdb.com/requester"
+
+var signerFlag = flag.String("signer", signerKubernetes, "how certificates are signed: kubernetes (the "+
+	"certificates.k8s.io CSR API), local-ca (with the CA in --ca-secret), cert-manager (with --issuer-name) "+
+	"or vault (with a Vault PKI role)")
+
+// Signer issues certificates for CSRs.
+type Signer interface {
+	// Submit sends a PEM-encoded CSR to be signed under the given name. A
+	// previous request with the same name is replaced if it was issued, denied
+	// or failed, or if this pod sent it; one still pending for another pod is
+	// an error.
+	Submit(ctx context.Context, name string, pemCSR []byte, wantServerAuth bool) error
+	// Wait blocks until the certificate for the request submitted under name
+	// is issued, and returns it PEM-encoded. It returns a *DeniedError if the
+	// request was denied, a *FailedError if signing failed, and a *TimeoutError
+	// if no certificate was issued in time.
+	Wait(ctx context.Context, name string) ([]byte, error)
+	// CA returns the PEM-encoded CA certificate to write to <certs-dir>/ca.crt
+	// for the certificate requested under name, or nil if the signer doesn't
+	// provide one.
+	CA(ctx context.Context, name string) ([]byte, error)
+	// Cancel deletes the request submitted under name if it is still waiting
+	// for approval. Signers which sign right away have nothing to cancel.
+	Cancel(ctx context.Context, name string) error
+}
+
+// signerCA returns the signer's CA for the certificate requested under name,
+// or storedCA, the CA stored with the certificate in its secret, if the signer
+// no longer has one. cert-manager, for example, only returns the CA with the
+// CertificateRequest, which may have been deleted since.
+func signerCA(ctx context.Context, signer Signer, name string, storedCA []byte) ([]byte, error) {
+	ca, err := signer.CA(ctx, name)
+	if err != nil || ca != nil {
+		return ca, err
+	}
+	return storedCA, nil
+}
+
+// DeniedError is returned by Signer.Wait when the request was denied.
+type DeniedError struct {
+	Name    string
+	Reason  string
+	Message string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("request %s was denied: %s: %s", e.Name, e.Reason, e.Message)
+}
+
+// FailedError is returned by Signer.Wait when the request was approved, but
+// the signer failed to issue the certificate.
+type FailedError struct {
+	Name    string
+	Reason  string
+	Message string
+}
+
+func (e *FailedError) Error() string {
+	return fmt.Sprintf("signing request %s failed: %s: %s", e.Name, e.Reason, e.Message)
+}
+
+// TimeoutError is returned by Signer.Wait when no certificate was issued in
+// time. Approved is true if the request was approved, but the certificate was
+// never issued, e.g. because no signer handles the request's signer name.
+type TimeoutError struct {
+	Name     string
+	Approved bool
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Approved {
+		return fmt.Sprintf("timed out waiting for the certificate of approved request %s to be issued", e.Name)
+	}
+	return fmt.Sprintf("timed out waiting for request %s to be approved", e.Name)
+}
+
+// printWaiting calls print every 30s until ctx is done, to show progress while
+// waiting for a certificate.
+func printWaiting(ctx context.Context, print func()) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			print()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// newSigner returns the Signer selected by --signer. requester is the hostname
+// of this pod, recorded in requesterAnnotation.
+func newSigner(ctx context.Context, requester string) (Signer, error) {
+	if len(*caSecret) != 0 && *signerFlag != signerLocalCA {
+		return nil, errors.Errorf("--ca-secret requires --signer=%s", signerLocalCA)
+	}
+	switch *signerFlag {
+	case signerKubernetes:
+		client, err := getClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return newKubernetesSigner(client, requester)
+	case signerLocalCA:
+		if len(*caSecret) == 0 {
+			return nil, errors.Errorf("--signer=%s requires --ca-secret", signerLocalCA)
+		}
+		if len(*symlinkCASource) != 0 {
+			return nil, errors.Errorf("--signer=%s writes ca.crt and can't be used with --symlink-ca-from", signerLocalCA)
+		}
+		client, err := getClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return newLocalCASigner(ctx, client, *caSecret)
+	case signerCertManager:
+		client, err := getDynamicClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return newCertManagerSigner(client, *namespace, *issuerName, *issuerKind, *issuerGroup, *certValidity, requester)
+	case signerVault:
+		return newVaultSigner()
+	default:
+		return nil, errors.Errorf("unknown --signer=%q. Valid signers are %q, %q, %q, %q",
+			*signerFlag, signerKubernetes, signerLocalCA, signerCertManager, signerVault)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	invalidSecretRenew = "renew"
+	invalidSecretFail  = "fail"
+	invalidSecretWarn  = "warn"
+)
+
+var invalidSecretPolicy = flag.String("invalid-secret-policy", invalidSecretRenew,
+	"what to do when the certificate in an existing secret doesn't match the requested one: "+
+		"renew (request a new certificate), fail or warn")
+
+// checkValidationFlags validates --invalid-secret-policy.
+func checkValidationFlags() error {
+	switch *invalidSecretPolicy {
+	case invalidSecretRenew, invalidSecretFail, invalidSecretWarn:
+		return nil
+	default:
+		return errors.Errorf("unknown --invalid-secret-policy=%q. Valid policies are %q, %q, %q",
+			*invalidSecretPolicy, invalidSecretRenew, invalidSecretFail, invalidSecretWarn)
+	}
+}
+
+// secretRenewalReason returns why the certificate and key found in a secret
+// must be replaced, or an empty string if they can be used. Certificates which
+// don't match the requested one are handled according to
+// --invalid-secret-policy, returning an error with the fail policy.
+func secretRenewalReason(
+	pemCert []byte, pemKey []byte, pemCA []byte, template *x509.CertificateRequest, wantServerAuth bool,
+) (string, error) {
+	if err := validateCertificate(pemCert, pemKey, pemCA, template, wantServerAuth); err != nil {
+		switch *invalidSecretPolicy {
+		case invalidSecretFail:
+			return "", err
+		case invalidSecretWarn:
+			log.Printf("WARNING: certificate in secret is invalid, using it anyway: %v\n", err)
+		default:
+			return fmt.Sprintf("is invalid (%v)", err), nil
+		}
+	}
+	return needsRenewal(pemCert, time.Now()), nil
+}
+
+// validateCertificate checks that the certificate and key found in a secret
+// can be used in place of a new certificate requested with template: the key
+// matches the certificate, the subject and SANs cover the template's, the
+// usages are the ones we request, and the certificate chains to the signer's
+// CA, pemCA, or to --symlink-ca-from. All problems found are returned in a
+// single error.
+func validateCertificate(
+	pemCert []byte, pemKey []byte, pemCA []byte, template *x509.CertificateRequest, wantServerAuth bool,
+) error {
+	pair, err := tls.X509KeyPair(pemCert, pemKey)
+	if err != nil {
+		return errors.Wrap(err, "certificate and key don't match")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return errors.Wrap(err, "error parsing certificate")
+	}
+
+	var problems []string
+	if cert.Subject.CommonName != template.Subject.CommonName {
+		problems = append(problems, "common name is "+cert.Subject.CommonName+", want "+template.Subject.CommonName)
+	}
+	for _, name := range template.DNSNames {
+		if err := cert.VerifyHostname(name); err != nil {
+			problems = append(problems, "missing DNS name "+name)
+		}
+	}
+	for _, ip := range template.IPAddresses {
+		if err := cert.VerifyHostname(ip.String()); err != nil {
+			problems = append(problems, "missing IP address "+ip.String())
+		}
+	}
+
+	usages := []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	if wantServerAuth {
+		usages = append(usages, x509.ExtKeyUsageServerAuth)
+	}
+	for _, usage := range usages {
+		if !hasExtKeyUsage(cert, usage) {
+			problems = append(problems, "missing usage "+extKeyUsageName(usage))
+		}
+	}
+
+	if pemCA != nil {
+		if err := verifyChain(cert, pair.Certificate[1:], pemCA, "the signer's CA"); err != nil {
+			problems = append(problems, err.Error())
+		}
+	} else if len(*symlinkCASource) != 0 {
+		pemCA, err := ioutil.ReadFile(*symlinkCASource)
+		if err != nil {
+			return errors.Wrapf(err, "could not read CA certificate %s", *symlinkCASource)
+		}
+		if err := verifyChain(cert, pair.Certificate[1:], pemCA, *symlinkCASource); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage || u == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
+
+func extKeyUsageName(usage x509.ExtKeyUsage) string {
+	switch usage {
+	case x509.ExtKeyUsageClientAuth:
+		return "client auth"
+	case x509.ExtKeyUsageServerAuth:
+		return "server auth"
+	default:
+		return "unknown"
+	}
+}
+
+// verifyChain checks that cert, with the given intermediates, chains to a CA
+// certificate in pemCA, read from source. The chain is verified now, so an
+// expired CA is reported. The expiry of cert itself is checked separately by
+// needsRenewal, so the time is clamped to cert's validity period.
+func verifyChain(cert *x509.Certificate, intermediates [][]byte, pemCA []byte, source string) error {
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pemCA) {
+		return errors.Errorf("no PEM-encoded certificate found in %s", source)
+	}
+
+	now := time.Now()
+	if now.After(cert.NotAfter) {
+		now = cert.NotAfter
+	} else if now.Before(cert.NotBefore) {
+		now = cert.NotBefore
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, der := range intermediates {
+		intermediate, err := x509.ParseCertificate(der)
+		if err != nil {
+			return errors.Wrap(err, "error parsing intermediate certificate")
+		}
+		opts.Intermediates.AddCert(intermediate)
+	}
+	if _, err := cert.Verify(opts); err != nil {
+		return errors.Wrapf(err, "does not chain to the CA in %s", source)
+	}
+	return nil
+}
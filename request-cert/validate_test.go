@@ -0,0 +1,295 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCert returns a PEM-encoded certificate signed by the CA, with the
+// names, usages and validity period of template, and its key.
+func newTestCert(t *testing.T, pemCA []byte, pemCAKey []byte, template *x509.Certificate) (pemCert []byte, pemKey []byte) {
+	t.Helper()
+	ca, err := parseCertificate(pemCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := parsePrivateKey(pemCAKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(2)
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// nodeCert returns a certificate template matching serverCSR for
+// cockroachdb-0 and 10.0.0.1, valid from notBefore for a day.
+func nodeCert(notBefore time.Time) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{Organization: []string{"Cockroach"}, CommonName: "node"},
+		DNSNames:    []string{"cockroachdb-0"},
+		IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+		NotBefore:   notBefore,
+		NotAfter:    notBefore.Add(24 * time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+}
+
+func TestValidateCertificate(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	pemCA, pemCAKey := newTestCA(t, now.Add(-time.Hour), true)
+	otherCA, otherCAKey := newTestCA(t, now.Add(-time.Hour), true)
+	expiredCA, expiredCAKey := newTestCA(t, now.Add(-48*time.Hour), true)
+
+	valid, validKey := newTestCert(t, pemCA, pemCAKey, nodeCert(now.Add(-time.Minute)))
+	_, otherKey := newTestCert(t, pemCA, pemCAKey, nodeCert(now.Add(-time.Minute)))
+	wrongName := nodeCert(now.Add(-time.Minute))
+	wrongName.Subject.CommonName = "root"
+	wrongNameCert, wrongNameKey := newTestCert(t, pemCA, pemCAKey, wrongName)
+	noSANs := nodeCert(now.Add(-time.Minute))
+	noSANs.DNSNames, noSANs.IPAddresses = nil, nil
+	noSANsCert, noSANsKey := newTestCert(t, pemCA, pemCAKey, noSANs)
+	clientOnly := nodeCert(now.Add(-time.Minute))
+	clientOnly.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	clientOnlyCert, clientOnlyKey := newTestCert(t, pemCA, pemCAKey, clientOnly)
+	wrongCACert, wrongCAKey := newTestCert(t, otherCA, otherCAKey, nodeCert(now.Add(-time.Minute)))
+	// The certificate outlives its CA, which has expired.
+	expiredCACert, expiredCACertKey := newTestCert(t, expiredCA, expiredCAKey, nodeCert(now.Add(-time.Minute)))
+	// An expired certificate is valid, as renewal is decided by needsRenewal.
+	expired := nodeCert(now.Add(-time.Hour))
+	expired.NotAfter = now.Add(-time.Minute)
+	expiredCert, expiredCertKey := newTestCert(t, pemCA, pemCAKey, expired)
+
+	testCases := []struct {
+		name           string
+		pemCert        []byte
+		pemKey         []byte
+		pemCA          []byte
+		wantServerAuth bool
+		// Substrings of the error, none if the certificate is valid.
+		wantErrs []string
+	}{
+		{name: "valid", pemCert: valid, pemKey: validKey, pemCA: pemCA, wantServerAuth: true},
+		{name: "no CA", pemCert: wrongCACert, pemKey: wrongCAKey, wantServerAuth: true},
+		{name: "expired", pemCert: expiredCert, pemKey: expiredCertKey, pemCA: pemCA, wantServerAuth: true},
+		{
+			name: "key mismatch", pemCert: valid, pemKey: otherKey, pemCA: pemCA, wantServerAuth: true,
+			wantErrs: []string{"certificate and key don't match"},
+		},
+		{
+			name: "wrong common name", pemCert: wrongNameCert, pemKey: wrongNameKey, pemCA: pemCA, wantServerAuth: true,
+			wantErrs: []string{"common name is root, want node"},
+		},
+		{
+			name: "missing SANs", pemCert: noSANsCert, pemKey: noSANsKey, pemCA: pemCA, wantServerAuth: true,
+			wantErrs: []string{"missing DNS name cockroachdb-0", "missing IP address 10.0.0.1"},
+		},
+		{
+			name: "missing usage", pemCert: clientOnlyCert, pemKey: clientOnlyKey, pemCA: pemCA, wantServerAuth: true,
+			wantErrs: []string{"missing usage server auth"},
+		},
+		{name: "client usage only", pemCert: clientOnlyCert, pemKey: clientOnlyKey, pemCA: pemCA},
+		{
+			name: "wrong CA", pemCert: wrongCACert, pemKey: wrongCAKey, pemCA: pemCA, wantServerAuth: true,
+			wantErrs: []string{"does not chain to the CA in the signer's CA"},
+		},
+		{
+			name: "expired CA", pemCert: expiredCACert, pemKey: expiredCACertKey, pemCA: expiredCA, wantServerAuth: true,
+			wantErrs: []string{"does not chain to the CA in the signer's CA"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateCertificate(tc.pemCert, tc.pemKey, tc.pemCA, serverCSR([]string{"cockroachdb-0", "10.0.0.1"}), tc.wantServerAuth)
+			if len(tc.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error containing %q", tc.wantErrs)
+			}
+			for _, want := range tc.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateCertificateSymlinkCA(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	pemCA, pemCAKey := newTestCA(t, now.Add(-time.Hour), true)
+	otherCA, otherCAKey := newTestCA(t, now.Add(-time.Hour), true)
+	caPath := filepath.Join(t.TempDir(), "ca.crt")
+	if err := ioutil.WriteFile(caPath, pemCA, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(path string) { *symlinkCASource = path }(*symlinkCASource)
+	*symlinkCASource = caPath
+
+	// Without a CA from the signer, the certificate must chain to the CA in
+	// --symlink-ca-from.
+	template := serverCSR([]string{"cockroachdb-0"})
+	pemCert, pemKey := newTestCert(t, pemCA, pemCAKey, nodeCert(now.Add(-time.Minute)))
+	if err := validateCertificate(pemCert, pemKey, nil, template, true); err != nil {
+		t.Error(err)
+	}
+	pemCert, pemKey = newTestCert(t, otherCA, otherCAKey, nodeCert(now.Add(-time.Minute)))
+	if err := validateCertificate(pemCert, pemKey, nil, template, true); err == nil || !strings.Contains(err.Error(), caPath) {
+		t.Errorf("got %v, want an error for the CA in %s", err, caPath)
+	}
+
+	*symlinkCASource = filepath.Join(t.TempDir(), "missing.crt")
+	if err := validateCertificate(pemCert, pemKey, nil, template, true); err == nil {
+		t.Error("expected an error for a missing --symlink-ca-from file")
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	pemCA, pemCAKey := newTestCA(t, now.Add(-time.Hour), true)
+	otherCA, _ := newTestCA(t, now.Add(-time.Hour), true)
+	expiredCA, expiredCAKey := newTestCA(t, now.Add(-48*time.Hour), true)
+
+	valid, _ := newTestCert(t, pemCA, pemCAKey, nodeCert(now.Add(-time.Minute)))
+	expired := nodeCert(now.Add(-time.Hour))
+	expired.NotAfter = now.Add(-time.Minute)
+	expiredCert, _ := newTestCert(t, pemCA, pemCAKey, expired)
+	// Issued while the CA was valid, and expired with it.
+	expiredWithCA := nodeCert(now.Add(-47 * time.Hour))
+	expiredWithCA.NotAfter = now.Add(-25 * time.Hour)
+	expiredWithCACert, _ := newTestCert(t, expiredCA, expiredCAKey, expiredWithCA)
+	outlivesCA, _ := newTestCert(t, expiredCA, expiredCAKey, nodeCert(now.Add(-time.Minute)))
+
+	testCases := []struct {
+		name    string
+		pemCert []byte
+		pemCA   []byte
+		wantErr bool
+	}{
+		{name: "valid", pemCert: valid, pemCA: pemCA},
+		// The expiry of the certificate itself is left to needsRenewal.
+		{name: "expired certificate", pemCert: expiredCert, pemCA: pemCA},
+		{name: "expired with its CA", pemCert: expiredWithCACert, pemCA: expiredCA},
+		{name: "expired CA", pemCert: outlivesCA, pemCA: expiredCA, wantErr: true},
+		{name: "wrong CA", pemCert: valid, pemCA: otherCA, wantErr: true},
+		{name: "invalid CA", pemCert: valid, pemCA: []byte("invalid"), wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cert, err := parseCertificate(tc.pemCert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verifyChain(cert, nil, tc.pemCA, "the test CA"); (err != nil) != tc.wantErr {
+				t.Errorf("got %v, want error: %t", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSecretRenewalReason(t *testing.T) {
+	defer func(policy string, before time.Duration) {
+		*invalidSecretPolicy, *renewBefore = policy, before
+	}(*invalidSecretPolicy, *renewBefore)
+	*renewBefore = time.Hour
+
+	now := time.Now().Truncate(time.Second)
+	pemCA, pemCAKey := newTestCA(t, now.Add(-time.Hour), true)
+	expiredCA, expiredCAKey := newTestCA(t, now.Add(-48*time.Hour), true)
+
+	valid, validKey := newTestCert(t, pemCA, pemCAKey, nodeCert(now.Add(-time.Minute)))
+	_, otherKey := newTestCert(t, pemCA, pemCAKey, nodeCert(now.Add(-time.Minute)))
+	expired := nodeCert(now.Add(-time.Hour))
+	expired.NotAfter = now.Add(-time.Minute)
+	expiredCert, expiredKey := newTestCert(t, pemCA, pemCAKey, expired)
+	outlivesCA, outlivesCAKey := newTestCert(t, expiredCA, expiredCAKey, nodeCert(now.Add(-time.Minute)))
+
+	type want struct {
+		// A substring of the reason, or "" if the certificate can be used.
+		reason  string
+		wantErr bool
+	}
+	testCases := []struct {
+		name    string
+		pemCert []byte
+		pemKey  []byte
+		pemCA   []byte
+		// What is expected under each --invalid-secret-policy.
+		renew, fail, warn want
+	}{
+		{name: "valid", pemCert: valid, pemKey: validKey, pemCA: pemCA},
+		{
+			// An expired certificate is renewed whatever the policy.
+			name: "expired certificate", pemCert: expiredCert, pemKey: expiredKey, pemCA: pemCA,
+			renew: want{reason: "expired at"},
+			fail:  want{reason: "expired at"},
+			warn:  want{reason: "expired at"},
+		},
+		{
+			name: "expired CA", pemCert: outlivesCA, pemKey: outlivesCAKey, pemCA: expiredCA,
+			renew: want{reason: "is invalid"},
+			fail:  want{wantErr: true},
+		},
+		{
+			name: "key mismatch", pemCert: valid, pemKey: otherKey, pemCA: pemCA,
+			renew: want{reason: "is invalid"},
+			fail:  want{wantErr: true},
+		},
+	}
+	for _, tc := range testCases {
+		for policy, w := range map[string]want{invalidSecretRenew: tc.renew, invalidSecretFail: tc.fail, invalidSecretWarn: tc.warn} {
+			t.Run(tc.name+"/"+policy, func(t *testing.T) {
+				*invalidSecretPolicy = policy
+				reason, err := secretRenewalReason(tc.pemCert, tc.pemKey, tc.pemCA, serverCSR([]string{"cockroachdb-0"}), true)
+				if (err != nil) != w.wantErr {
+					t.Fatalf("got %v, want error: %t", err, w.wantErr)
+				}
+				if (w.reason == "") != (reason == "") || !strings.Contains(reason, w.reason) {
+					t.Errorf("got reason %q, want %q", reason, w.reason)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+var (
+	vaultAddr      = flag.String("vault-addr", os.Getenv("VAULT_ADDR"), "with --signer=vault, the address of Vault; defaults to $VAULT_ADDR")
+	vaultAuthMount = flag.String("vault-auth-mount", "kubernetes", "with --signer=vault, the mount path of the Kubernetes auth method")
+	vaultAuthRole  = flag.String("vault-auth-role", "", "with --signer=vault, the Kubernetes auth role to log in with")
+	vaultPKIMount  = flag.String("vault-pki-mount", "pki", "with --signer=vault, the mount path of the PKI secrets engine")
+	vaultPKIRole   = flag.String("vault-pki-role", "", "with --signer=vault, the PKI role signing the certificates")
+	vaultCACert    = flag.String("vault-ca-cert", "", "with --signer=vault, if non-empty, a PEM file with the CA "+
+		"certificates trusted to verify Vault's TLS certificate instead of the system's")
+	vaultTokenPath = flag.String("vault-jwt-path", defaultServiceAccountTokenPath,
+		"with --signer=vault, the service account token used to log in")
+)
+
+// vaultSigner signs CSRs with a Vault PKI role, logging in with the Kubernetes
+// auth method.
+type vaultSigner struct {
+	client *http.Client
+	// The address of Vault, e.g. https://vault:8200.
+	addr      string
+	authMount string
+	authRole  string
+	pkiMount  string
+	pkiRole   string
+	jwtPath   string
+	ttl       time.Duration
+
+	// The Vault token obtained by logging in.
+	token string
+	// The certificates signed, and the CA which issued them, by request name.
+	certs map[string][]byte
+	ca    []byte
+}
+
+func newVaultSigner() (*vaultSigner, error) {
+	if *vaultAddr == "" {
+		return nil, errors.Errorf("--signer=%s requires --vault-addr or $VAULT_ADDR", signerVault)
+	}
+	if *vaultAuthRole == "" || *vaultPKIRole == "" {
+		return nil, errors.Errorf("--signer=%s requires --vault-auth-role and --vault-pki-role", signerVault)
+	}
+	client, err := vaultHTTPClient(*vaultCACert)
+	if err != nil {
+		return nil, err
+	}
+	return &vaultSigner{
+		client:    client,
+		addr:      strings.TrimSuffix(*vaultAddr, "/"),
+		authMount: strings.Trim(*vaultAuthMount, "/"),
+		authRole:  *vaultAuthRole,
+		pkiMount:  strings.Trim(*vaultPKIMount, "/"),
+		pkiRole:   *vaultPKIRole,
+		jwtPath:   *vaultTokenPath,
+		ttl:       *certValidity,
+		certs:     make(map[string][]byte),
+	}, nil
+}
+
+// vaultHTTPClient returns an HTTP client trusting the CA certificates in
+// caFile, or the system's if empty.
+func vaultHTTPClient(caFile string) (*http.Client, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	if caFile == "" {
+		return client, nil
+	}
+	pemCA, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read --vault-ca-cert %s", caFile)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pemCA) {
+		return nil, errors.Errorf("no PEM-encoded certificate found in --vault-ca-cert %s", caFile)
+	}
+	client.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}
+	return client, nil
+}
+
+// vaultResponse is the part of Vault API responses we use.
+type vaultResponse struct {
+	Errors []string `json:"errors"`
+	Auth   struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+	Data struct {
+		Certificate string   `json:"certificate"`
+		IssuingCA   string   `json:"issuing_ca"`
+		CAChain     []string `json:"ca_chain"`
+	} `json:"data"`
+}
+
+// vaultError is a failed Vault API request.
+type vaultError struct {
+	path       string
+	statusCode int
+	errors     []string
+}
+
+func (e *vaultError) Error() string {
+	return fmt.Sprintf("vault request %s failed with status %d: %s", e.path, e.statusCode, strings.Join(e.errors, "; "))
+}
+
+// do sends a request to the Vault API and decodes the response.
+func (s *vaultSigner) do(ctx context.Context, method string, path string, body interface{}) (*vaultResponse, error) {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return nil, errors.Wrapf(err, "error encoding vault request %s", path)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.addr+"/v1/"+path, &reqBody)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error building vault request %s", path)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("X-Vault-Token", s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "vault request %s failed", path)
+	}
+	defer resp.Body.Close()
+
+	var vaultResp vaultResponse
+	if err := json.NewDecoder(resp.Body).Decode(&vaultResp); err != nil && resp.StatusCode < 300 {
+		return nil, errors.Wrapf(err, "error decoding vault response %s", path)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, &vaultError{path: path, statusCode: resp.StatusCode, errors: vaultResp.Errors}
+	}
+	return &vaultResp, nil
+}
+
+// login exchanges the service account token for a Vault token.
+func (s *vaultSigner) login(ctx context.Context) error {
+	jwt, err := ioutil.ReadFile(s.jwtPath)
+	if err != nil {
+		return errors.Wrapf(err, "could not read service account token %s", s.jwtPath)
+	}
+	path := "auth/" + s.authMount + "/login"
+	resp, err := s.do(ctx, http.MethodPost, path, map[string]string{
+		"role": s.authRole,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Auth.ClientToken == "" {
+		return errors.Errorf("vault login %s returned no token", path)
+	}
+	s.token = resp.Auth.ClientToken
+	return nil
+}
+
+// Submit logs in and signs the CSR with the PKI role right away. Requests the
+// role doesn't allow are reported as denied.
+func (s *vaultSigner) Submit(ctx context.Context, name string, pemCSR []byte, wantServerAuth bool) error {
+	if err := s.login(ctx); err != nil {
+		return err
+	}
+	path := s.pkiMount + "/sign/" + s.pkiRole
+	fmt.Printf("Sending CSR %s to vault %s\n", name, path)
+	resp, err := s.do(ctx, http.MethodPost, path, map[string]string{
+		"csr":    string(pemCSR),
+		"ttl":    s.ttl.String(),
+		"format": "pem",
+	})
+	if vaultErr, ok := err.(*vaultError); ok &&
+		(vaultErr.statusCode == http.StatusBadRequest || vaultErr.statusCode == http.StatusForbidden) {
+		return &DeniedError{Name: name, Reason: http.StatusText(vaultErr.statusCode), Message: strings.Join(vaultErr.errors, "; ")}
+	}
+	if err != nil {
+		return err
+	}
+	if resp.Data.Certificate == "" {
+		return errors.Errorf("vault request %s returned no certificate", path)
+	}
+	s.certs[name] = []byte(resp.Data.Certificate + "\n")
+	// The chain also holds the parents of an intermediate issuing CA.
+	switch {
+	case len(resp.Data.CAChain) != 0:
+		s.ca = []byte(strings.Join(resp.Data.CAChain, "\n") + "\n")
+	case resp.Data.IssuingCA != "":
+		s.ca = []byte(resp.Data.IssuingCA + "\n")
+	}
+	return nil
+}
+
+// Wait returns the certificate signed by Submit.
+func (s *vaultSigner) Wait(ctx context.Context, name string) ([]byte, error) {
+	pemCert, ok := s.certs[name]
+	if !ok {
+		return nil, errors.Errorf("no request %s was submitted", name)
+	}
+	delete(s.certs, name)
+	return pemCert, nil
+}
+
+// CA returns the CA chain which issued the last certificate, or else the CA of
+// the PKI mount.
+func (s *vaultSigner) CA(ctx context.Context, name string) ([]byte, error) {
+	if s.ca != nil {
+		return s.ca, nil
+	}
+	path := s.pkiMount + "/ca/pem"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.addr+"/v1/"+path, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error building vault request %s", path)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "vault request %s failed", path)
+	}
+	defer resp.Body.Close()
+	pemCA, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading vault response %s", path)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &vaultError{path: path, statusCode: resp.StatusCode}
+	}
+	s.ca = pemCA
+	return pemCA, nil
+}
+
+// Cancel does nothing: requests are signed by Submit.
+func (s *vaultSigner) Cancel(ctx context.Context, name string) error {
+	return nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2026 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testVaultToken = "s.vault-token"
+
+// fakeVault is an httptest stand-in for the Vault API. It accepts logins to
+// auth/kubernetes with the cockroachdb role, and answers sign requests to
+// pki_int/sign/cockroachdb-node with signResponse.
+type fakeVault struct {
+	t            *testing.T
+	loginStatus  int
+	signStatus   int
+	signResponse map[string]interface{}
+	caStatus     int
+	// The body of the last sign request.
+	signRequest map[string]string
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON := func(status int, body interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			v.t.Error(err)
+		}
+	}
+	vaultErrors := func(status int, errs ...string) {
+		writeJSON(status, map[string]interface{}{"errors": errs})
+	}
+
+	switch r.URL.Path {
+	case "/v1/auth/kubernetes/login":
+		var req map[string]string
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+			vaultErrors(http.StatusBadRequest, "invalid login request")
+			return
+		}
+		if v.loginStatus != 0 {
+			vaultErrors(v.loginStatus, "permission denied")
+			return
+		}
+		if req["role"] != "cockroachdb" || req["jwt"] != "service-account-token" {
+			vaultErrors(http.StatusForbidden, "invalid role or jwt")
+			return
+		}
+		writeJSON(http.StatusOK, map[string]interface{}{"auth": map[string]interface{}{"client_token": testVaultToken}})
+	case "/v1/pki_int/sign/cockroachdb-node":
+		if r.Header.Get("X-Vault-Token") != testVaultToken {
+			vaultErrors(http.StatusForbidden, "permission denied")
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&v.signRequest); err != nil {
+			vaultErrors(http.StatusBadRequest, "invalid sign request")
+			return
+		}
+		if v.signStatus != 0 {
+			vaultErrors(v.signStatus, "common name node not allowed by this role")
+			return
+		}
+		writeJSON(http.StatusOK, map[string]interface{}{"data": v.signResponse})
+	case "/v1/pki_int/ca/pem":
+		if v.caStatus != 0 {
+			w.WriteHeader(v.caStatus)
+			return
+		}
+		w.Write([]byte("mount CA\n"))
+	default:
+		vaultErrors(http.StatusNotFound)
+	}
+}
+
+// newTestVaultSigner returns a vaultSigner using a fake Vault.
+func newTestVaultSigner(t *testing.T, v *fakeVault) *vaultSigner {
+	t.Helper()
+	v.t = t
+	server := httptest.NewServer(v)
+	t.Cleanup(server.Close)
+
+	jwtPath := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(jwtPath, []byte("service-account-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &vaultSigner{
+		client:    server.Client(),
+		addr:      server.URL,
+		authMount: "kubernetes",
+		authRole:  "cockroachdb",
+		pkiMount:  "pki_int",
+		pkiRole:   "cockroachdb-node",
+		jwtPath:   jwtPath,
+		ttl:       90 * 24 * time.Hour,
+		certs:     make(map[string][]byte),
+	}
+}
+
+func TestVaultSigner(t *testing.T) {
+	testCases := []struct {
+		name   string
+		data   map[string]interface{}
+		wantCA string
+	}{
+		{
+			name: "CA chain",
+			data: map[string]interface{}{
+				"certificate": "node cert",
+				"issuing_ca":  "intermediate CA",
+				"ca_chain":    []string{"intermediate CA", "root CA"},
+			},
+			wantCA: "intermediate CA\nroot CA\n",
+		},
+		{
+			name:   "issuing CA",
+			data:   map[string]interface{}{"certificate": "node cert", "issuing_ca": "intermediate CA"},
+			wantCA: "intermediate CA\n",
+		},
+		{
+			name:   "no CA",
+			data:   map[string]interface{}{"certificate": "node cert"},
+			wantCA: "mount CA\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v := &fakeVault{signResponse: tc.data}
+			s := newTestVaultSigner(t, v)
+			ctx := context.Background()
+
+			if err := s.Submit(ctx, testRequestName, []byte("pem CSR"), true); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]string{"csr": "pem CSR", "ttl": "2160h0m0s", "format": "pem"}
+			for k, value := range want {
+				if v.signRequest[k] != value {
+					t.Errorf("sign request %s is %q, want %q", k, v.signRequest[k], value)
+				}
+			}
+
+			cert, err := s.Wait(ctx, testRequestName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(cert) != "node cert\n" {
+				t.Errorf("got certificate %q, want %q", cert, "node cert\n")
+			}
+			if _, err := s.Wait(ctx, testRequestName); err == nil {
+				t.Error("expected an error waiting for the certificate twice")
+			}
+
+			ca, err := s.CA(ctx, testRequestName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(ca) != tc.wantCA {
+				t.Errorf("got CA %q, want %q", ca, tc.wantCA)
+			}
+		})
+	}
+}
+
+func TestVaultSignerErrors(t *testing.T) {
+	testCases := []struct {
+		name       string
+		vault      fakeVault
+		wantDenied bool
+	}{
+		{name: "login rejected", vault: fakeVault{loginStatus: http.StatusForbidden}},
+		{name: "sign rejected", vault: fakeVault{signStatus: http.StatusBadRequest}, wantDenied: true},
+		{name: "sign forbidden", vault: fakeVault{signStatus: http.StatusForbidden}, wantDenied: true},
+		{name: "sign failed", vault: fakeVault{signStatus: http.StatusInternalServerError}},
+		{name: "no certificate", vault: fakeVault{signResponse: map[string]interface{}{}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestVaultSigner(t, &tc.vault)
+			err := s.Submit(context.Background(), testRequestName, []byte("pem CSR"), true)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if _, denied := err.(*DeniedError); denied != tc.wantDenied {
+				t.Errorf("got %T %v, want denied = %t", err, err, tc.wantDenied)
+			}
+		})
+	}
+
+	s := newTestVaultSigner(t, &fakeVault{caStatus: http.StatusNotFound})
+	if ca, err := s.CA(context.Background(), testRequestName); err == nil {
+		t.Errorf("expected an error reading the mount's CA, got %q", ca)
+	}
+}